@@ -0,0 +1,104 @@
+package otelgrpcgw
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/crazyfrankie/otelgrpcgw/internal/semconv"
+)
+
+// metricsDroppedName is the name of the counter of the request metrics dropped
+// because the queue of a middleware configured WithAsyncMetrics was full.
+const metricsDroppedName = "otelgrpcgw.metrics.dropped"
+
+type asyncRecord struct {
+	ctx  context.Context
+	data semconv.ServerMetricData
+}
+
+// asyncMetrics records request metrics on a background goroutine, see
+// WithAsyncMetrics.
+type asyncMetrics struct {
+	semconv semconv.HTTPServer
+	dropped metric.Int64Counter
+
+	queue chan asyncRecord
+	// mu is held for reading while a record is queued and for writing while
+	// closing, so that nothing is queued once the queue is drained.
+	mu        sync.RWMutex
+	closed    bool
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newAsyncMetrics(s semconv.HTTPServer, meter metric.Meter, size int) *asyncMetrics {
+	a := &asyncMetrics{
+		semconv: s,
+		queue:   make(chan asyncRecord, size),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	var err error
+	a.dropped, err = meter.Int64Counter(metricsDroppedName,
+		metric.WithUnit("{request}"),
+		metric.WithDescription("Number of requests whose metrics were dropped because the recording queue was full."))
+	if err != nil {
+		otel.Handle(err)
+		a.dropped = metricnoop.Int64Counter{}
+	}
+	go a.run()
+	return a
+}
+
+func (a *asyncMetrics) run() {
+	defer close(a.done)
+	for {
+		select {
+		case rec := <-a.queue:
+			a.semconv.RecordMetrics(rec.ctx, rec.data)
+		case <-a.quit:
+			// Flush what was queued before close.
+			for {
+				select {
+				case rec := <-a.queue:
+					a.semconv.RecordMetrics(rec.ctx, rec.data)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// record queues data to be recorded, or drops it if the queue is full or a is
+// closed.
+func (a *asyncMetrics) record(ctx context.Context, data semconv.ServerMetricData) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		a.dropped.Add(ctx, 1)
+		return
+	}
+	select {
+	case a.queue <- asyncRecord{ctx: context.WithoutCancel(ctx), data: data}:
+	default:
+		a.dropped.Add(ctx, 1)
+	}
+}
+
+// close records the queued metrics and stops the background goroutine.
+func (a *asyncMetrics) close() {
+	a.closeOnce.Do(func() {
+		a.mu.Lock()
+		a.closed = true
+		a.mu.Unlock()
+		close(a.quit)
+	})
+	<-a.done
+}
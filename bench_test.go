@@ -0,0 +1,70 @@
+package otelgrpcgw_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/crazyfrankie/otelgrpcgw"
+)
+
+func benchmarkHandler(b *testing.B, h runtime.HandlerFunc) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/hello", nil)
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h(w, r, nil)
+	}
+}
+
+func benchmarkHostHandler(b *testing.B, host string, h runtime.HandlerFunc) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/hello", nil)
+	r.Host = host
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h(w, r, nil)
+	}
+}
+
+func BenchmarkHandler(b *testing.B) {
+	next := func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	b.Run("FastPath", func(b *testing.B) {
+		benchmarkHandler(b, otelgrpcgw.NewHandler(next, "/",
+			otelgrpcgw.WithTracerProvider(tracenoop.NewTracerProvider()),
+			otelgrpcgw.WithMeterProvider(metricnoop.NewMeterProvider()),
+		))
+	})
+
+	b.Run("FullPath", func(b *testing.B) {
+		// The global providers are no-op by default, but may be replaced at
+		// any time, so the full instrumentation path is taken.
+		benchmarkHandler(b, otelgrpcgw.NewHandler(next, "/"))
+	})
+}
+
+func BenchmarkFixedServerPort(b *testing.B) {
+	next := func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// Both record server.port 8080, from the Host header or the fixed port.
+	b.Run("HostPort", func(b *testing.B) {
+		benchmarkHostHandler(b, "example.com:8080", otelgrpcgw.NewHandler(next, "/"))
+	})
+
+	b.Run("FixedPort", func(b *testing.B) {
+		benchmarkHostHandler(b, "example.com:3128", otelgrpcgw.NewHandler(next, "/", otelgrpcgw.WithFixedServerPort(8080)))
+	})
+}
@@ -0,0 +1,68 @@
+package otelgrpcgw
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// binaryTraceContextLen is the length of the grpc-trace-bin binary format:
+// a version byte followed by the trace ID, span ID and trace options fields,
+// each prefixed with its field ID.
+const binaryTraceContextLen = 1 + 1 + 16 + 1 + 8 + 1 + 1
+
+// binaryPropagator propagates the span context in the base64-encoded binary
+// format of the grpc-trace-bin header.
+type binaryPropagator struct {
+	header string
+}
+
+var _ propagation.TextMapPropagator = binaryPropagator{}
+
+func (p binaryPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	b := make([]byte, 0, binaryTraceContextLen)
+	tid, sid := sc.TraceID(), sc.SpanID()
+	b = append(b, 0, 0)
+	b = append(b, tid[:]...)
+	b = append(b, 1)
+	b = append(b, sid[:]...)
+	b = append(b, 2, byte(sc.TraceFlags()&trace.FlagsSampled))
+	carrier.Set(p.header, base64.StdEncoding.EncodeToString(b))
+}
+
+func (p binaryPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	sc, ok := parseBinaryTraceContext(carrier.Get(p.header))
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func (p binaryPropagator) Fields() []string {
+	return []string{p.header}
+}
+
+// parseBinaryTraceContext decodes a base64-encoded grpc-trace-bin value, with
+// or without padding.
+func parseBinaryTraceContext(value string) (trace.SpanContext, bool) {
+	b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil || len(b) < binaryTraceContextLen || b[0] != 0 || b[1] != 0 || b[18] != 1 || b[27] != 2 {
+		return trace.SpanContext{}, false
+	}
+
+	var cfg trace.SpanContextConfig
+	copy(cfg.TraceID[:], b[2:18])
+	copy(cfg.SpanID[:], b[19:27])
+	cfg.TraceFlags = trace.TraceFlags(b[28]) & trace.FlagsSampled
+	cfg.Remote = true
+	sc := trace.NewSpanContext(cfg)
+	return sc, sc.IsValid()
+}
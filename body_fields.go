@@ -0,0 +1,107 @@
+package otelgrpcgw
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultBodyFieldLimit is the default maximum number of body bytes inspected
+// to extract JSON field attributes.
+const defaultBodyFieldLimit = 64 << 10
+
+// peekRequestBodyFields reads up to limit bytes of the request body, extracts
+// the given top-level JSON fields and restores the body so the handler still
+// reads it intact. Bodies that are larger than limit or not a JSON object
+// yield no attributes.
+func peekRequestBodyFields(r *http.Request, fields []string, limit int) []attribute.KeyValue {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	peeked, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), r.Body), r.Body}
+	if err != nil || len(peeked) > limit {
+		return nil
+	}
+	return jsonFieldAttributes(RequestBodyFieldKeyPrefix, peeked, fields)
+}
+
+// isJSONMediaType reports whether mt is application/json or a structured
+// syntax media type with the +json suffix such as application/merge-patch+json.
+func isJSONMediaType(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// responseBodyCapture keeps a copy of the start of a response body to extract
+// JSON field attributes from it.
+type responseBodyCapture struct {
+	buf   []byte
+	limit int
+}
+
+// capture appends b to the copy, stopping one byte past limit so that larger
+// bodies can be told apart.
+func (c *responseBodyCapture) capture(b []byte) {
+	if room := c.limit + 1 - len(c.buf); room > 0 {
+		c.buf = append(c.buf, b[:min(room, len(b))]...)
+	}
+}
+
+// attributes returns the given top-level JSON fields of the captured body.
+// Bodies that are larger than limit or not a JSON object yield no attributes.
+func (c *responseBodyCapture) attributes(fields []string) []attribute.KeyValue {
+	if len(c.buf) > c.limit {
+		return nil
+	}
+	return jsonFieldAttributes(ResponseBodyFieldKeyPrefix, c.buf, fields)
+}
+
+// jsonFieldAttributes returns an attribute named prefix+field for each of the
+// fields found at the top level of the JSON object in data.
+func jsonFieldAttributes(prefix string, data []byte, fields []string) []attribute.KeyValue {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil
+	}
+
+	var attrs []attribute.KeyValue
+	for _, field := range fields {
+		raw, ok := obj[field]
+		if !ok {
+			continue
+		}
+		key := attribute.Key(prefix + field)
+
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			attrs = append(attrs, key.String(v))
+		case bool:
+			attrs = append(attrs, key.Bool(v))
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				attrs = append(attrs, key.Int64(i))
+			} else if f, err := v.Float64(); err == nil {
+				attrs = append(attrs, key.Float64(f))
+			}
+		case nil:
+		default:
+			// Objects and arrays are recorded as their JSON text.
+			attrs = append(attrs, key.String(string(raw)))
+		}
+	}
+	return attrs
+}
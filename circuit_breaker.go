@@ -0,0 +1,44 @@
+package otelgrpcgw
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// circuitBreaker pauses tracing after consecutive span export failures, see
+// WithTracingCircuitBreaker. A nil *circuitBreaker never pauses tracing.
+type circuitBreaker struct {
+	threshold int64
+	cooldown  time.Duration
+
+	failures  atomic.Int64
+	openUntil atomic.Int64 // unix nanoseconds
+}
+
+// report records the result of a span export.
+func (b *circuitBreaker) report(err error) {
+	if b == nil {
+		return
+	}
+	if err == nil {
+		b.failures.Store(0)
+		return
+	}
+	if b.failures.Add(1) >= b.threshold {
+		b.failures.Store(0)
+		b.openUntil.Store(time.Now().Add(b.cooldown).UnixNano())
+	}
+}
+
+// isOpen reports whether tracing is paused.
+func (b *circuitBreaker) isOpen() bool {
+	return b != nil && time.Now().UnixNano() < b.openUntil.Load()
+}
+
+// ReportExportResult reports the result of exporting spans to the circuit
+// breaker of a middleware configured WithTracingCircuitBreaker, and is a no-op
+// otherwise. It is meant to be called by the span exporter, or a wrapper of
+// it, with the error of every export.
+func (m *Middleware) ReportExportResult(err error) {
+	m.h.breaker.report(err)
+}
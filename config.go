@@ -4,6 +4,9 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptrace"
+	"reflect"
+	"strings"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -28,28 +31,164 @@ type config struct {
 	SpanNameFormatter  func(string, *http.Request) string
 	TracerProvider     trace.TracerProvider
 	MeterProvider      metric.MeterProvider
+
+	DiagnosticAttrs          bool                                                         // Whether to record attributes that help debugging the middleware configuration itself
+	SpanStartOptionsFn       func(context.Context, *http.Request) []trace.SpanStartOption // Per-request span options computed from the extracted context
+	BodyChecksum             bool                                                         // Whether to record a checksum of the request body
+	ResourceAttributes       []attribute.KeyValue                                         // Static attributes added to every span and metric
+	RetryAttemptHeader       string                                                       // Request header carrying the client retry attempt number
+	DecodeRequestSize        bool                                                         // Whether to record the decompressed size of compressed request bodies
+	BodyFields               []string                                                     // Top-level JSON request body fields recorded as span attributes
+	BodyFieldLimit           int                                                          // Maximum number of body bytes inspected to extract JSON fields
+	StatusWriteEvent         bool                                                         // Whether to add an event when the response status is written
+	CarrierFn                func(*http.Request) propagation.TextMapCarrier               // Carrier the trace context is extracted from, defaults to the request headers
+	RequestContentType       bool                                                         // Whether to record the request media type
+	ContentTypeMetricTypes   []string                                                     // Request media types recorded on metrics, others are recorded as other
+	MetricAttributeAllowlist []string                                                     // Keys of the Labeler and MetricAttributesFn attributes allowed on metrics
+	MethodOverrideHeader     string                                                       // Request header carrying the effective method of tunneled requests
+	DrainRequestBody         int                                                          // Maximum number of unread request body bytes drained after the handler returns
+	CorrelationLinkHeader    string                                                       // Request header carrying an out-of-band trace to link to
+	CacheStatusHeader        string                                                       // Response header telling whether the response was served from a cache
+	PatternObserver          func(*http.Request, map[string]string) (string, bool)        // Reports the grpc-gateway pattern that matched a request
+	ErrorOnlyAttributesFn    func(*http.Request, int) []attribute.KeyValue                // Span attributes only computed for failed requests
+	EnduserExtractor         func(context.Context) (string, string, bool)                 // Returns the authenticated principal stored in the request context
+	MetricNamer              func(string) string                                          // Returns the name instruments are created under given their default name
+	TimestampAttrs           bool                                                         // Whether to record the request start and response end wall-clock times
+	TraceFilters             []Filter                                                     // Filters deciding whether a request is traced, metrics are recorded regardless
+	BackendResolver          func(*http.Request, map[string]string) string                // Returns the address of the gRPC backend a request is forwarded to
+	LatencyBuckets           bool                                                         // Whether to record a coarse latency bucket on the span
+	LatencyFast              time.Duration                                                // Requests faster than this are in the fast latency bucket
+	LatencySlow              time.Duration                                                // Requests at least this slow are in the slow latency bucket
+	BinaryTraceHeader        string                                                       // Request header carrying the span context in the grpc-trace-bin binary format
+	MaxBodyEvents            int                                                          // Maximum number of read and write events added to a span, 0 for no limit
+	SamplingDecisionAttr     bool                                                         // Whether to record the sampling decision of the span
+	SpanNameTemplate         string                                                       // Template the span name is rendered from, overriding SpanNameFormatter
+	SchemeResolver           func(*http.Request) string                                   // Returns the scheme the client used, defaults to X-Forwarded-Proto then r.TLS
+	SelfStats                bool                                                         // Whether to count the requests seen by the middleware, see Middleware.Stats
+	ResponseBodyFields       []string                                                     // Top-level JSON response body fields recorded as span attributes
+	PathParamCount           bool                                                         // Whether to record the number of matched path parameters
+	TrustedProxyCount        int                                                          // Number of trusted proxy addresses at the end of X-Forwarded-For
+	SNIServerAddress         bool                                                         // Whether to record the TLS SNI server name as server.address
+	DropUnmatchedRoutes      bool                                                         // Whether to mark the spans of 404 responses without a known route or path parameters
+	APIVersionAttr           bool                                                         // Whether to record the API version of requests
+	APIVersionExtractor      func(*http.Request, map[string]string) string                // Returns the API version of a request, defaults to the first vN route segment
+	RateLimitHeaders         [3]string                                                    // Response headers carrying the rate limit, remaining requests and reset time
+	ClientCertAttrs          bool                                                         // Whether to record the subject and serial of the TLS client certificate
+	FilterPanicPolicy        FilterPanicPolicy                                            // Whether requests are instrumented when a filter panics
+	OperationGroupFn         func(*http.Request, map[string]string) string                // Returns the logical operation group of a request
+	ConcurrencySnapshot      time.Duration                                                // Requests slower than this record the concurrency at their end, 0 to disable
+	NoBodyWrapContentTypes   []string                                                     // Request media types whose bodies are not wrapped to count the bytes read
+	PathParamEvents          []string                                                     // Path parameters recorded on a route.params span event
+	RecordEOFErrors          bool                                                         // Whether io.EOF is recorded as a read or write error
+	RouteResolver            func(*http.Request) string                                   // Returns the route template of a request, defaults to the matched grpc-gateway pattern
+	OperationFromRoute       bool                                                         // Whether the resolved route replaces the static operation
+	ResponsePropagator       propagation.TextMapPropagator                                // Propagator injecting the span context into the response headers
+	TenantExtractor          func(*http.Request) string                                   // Returns the logical tenant of a request
+	NanosecondDurationAttr   bool                                                         // Whether to record the request duration in nanoseconds on the span
+	MetricsFollowSampling    bool                                                         // Whether metrics are only recorded for sampled spans
+	LanguageAttr             bool                                                         // Whether to record the preferred language of the Accept-Language header
+	FixedServerPort          int                                                          // Port recorded as server.port instead of the port of the Host header
+	HTTP2StreamID            func(*http.Request) (uint32, bool)                           // Returns the HTTP/2 stream ID a request was received on
+	TraceStateFn             func(*http.Request, trace.TraceState) trace.TraceState       // Returns the trace state the span is started with
+	OriginAllowlist          []string                                                     // Origin header values recorded verbatim, others are recorded as other
+	ResponseCompressedAttr   bool                                                         // Whether to record if the response has a Content-Encoding
+	TransactionIDExtractor   func(*http.Request, http.Header) (string, bool)              // Returns the business transaction ID of a request once it is handled
+	BreakerThreshold         int                                                          // Consecutive span export failures pausing tracing, 0 to disable
+	BreakerCooldown          time.Duration                                                // How long tracing is paused after BreakerThreshold export failures
+	RangeAttrs               bool                                                         // Whether to record the Range request and Content-Range response headers
+	FullURLAttr              bool                                                         // Whether to record the full request URL with its sensitive query parameters redacted
+	RedactedQueryParams      []string                                                     // Query parameters redacted from the full URL in addition to the default ones
+	CustomVerbResolver       func(*http.Request) string                                   // Returns the custom method verb of a request, e.g. batchGet
+	HighLoadThreshold        int                                                          // In-flight requests above which optional metric attributes are dropped, 0 to disable
+	BodyCloseEvent           bool                                                         // Whether to add a span event when the request body is closed
+	InstanceAttrs            bool                                                         // Whether to record the host name and process ID of the server
+	DeadlinePropagationAttrs bool                                                         // Whether to record the deadline propagated to the gRPC backend
+	CombinedProtocolAttr     bool                                                         // Whether to record the scheme and protocol version as a single attribute
+	IdempotencyKeyHeader     string                                                       // Request header carrying the idempotency key of the request
+	SkipIfInstrumented       bool                                                         // Whether requests already instrumented by an outer middleware are skipped
+	CacheValidatorAttrs      bool                                                         // Whether to record the ETag and Last-Modified response headers
+	ConditionalRequestAttr   bool                                                         // Whether to record if the request is conditional
+	FlushCountAttr           bool                                                         // Whether to record the number of times the response was flushed
+	HeaderSizeAttrs          bool                                                         // Whether to record the number and size of the request headers
+	AsyncMetricsBuffer       int                                                          // Size of the queue of metrics recorded in the background, 0 to record them inline
+	GeoHeader                string                                                       // Request header carrying the country code of the client set by a CDN
+	AuthSchemeAttr           bool                                                         // Whether to record the scheme of the Authorization header
+	ResponseSizeBuckets      []int                                                        // Response sizes separating the response size buckets, in any order
+	OutboundContentTypeAttr  bool                                                         // Whether to record the Content-Type of the response
+	JWTClaimPaths            []string                                                     // Dot-separated paths of the token claims to record
+	ClaimsExtractor          func(context.Context) map[string]any                         // Returns the claims of the validated token stored in the request context
+	PhaseEvents              bool                                                         // Whether to add span events marking the phases of request processing
+	SamplingPriorityFn       func(*http.Request, int, time.Duration) int                  // Returns the sampling priority hinted to tail-based samplers
+	VaryAttr                 bool                                                         // Whether to record the Vary response header
 }
 
 type Option func(*config)
 
 func newConfig(opts ...Option) *config {
 	c := &config{
-		Propagators:   otel.GetTextMapPropagator(),
-		MeterProvider: otel.GetMeterProvider(),
+		Propagators:    otel.GetTextMapPropagator(),
+		MeterProvider:  otel.GetMeterProvider(),
+		BodyFieldLimit: defaultBodyFieldLimit,
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	if c.Propagators == nil {
+		// An empty composite propagator neither extracts nor injects anything.
+		c.Propagators = propagation.NewCompositeTextMapPropagator()
+	}
+	if c.BinaryTraceHeader != "" {
+		// Extracted first so that a text trace context takes precedence.
+		c.Propagators = propagation.NewCompositeTextMapPropagator(binaryPropagator{header: c.BinaryTraceHeader}, c.Propagators)
+	}
+
 	if c.TracerProvider != nil {
 		c.Tracer = newTracer(c.TracerProvider)
 	}
 
 	c.Meter = newMeter(c.MeterProvider)
+	if c.MetricNamer != nil {
+		c.Meter = newRenamingMeter(c.Meter, c.MetricNamer)
+	}
 
 	return c
 }
 
+// fastPathFields are the config fields whose value does not matter when neither
+// tracing nor metrics record anything, other than those deciding how the trace
+// context is extracted.
+var fastPathFields = map[string]bool{
+	"ServerName":         true,
+	"Tracer":             true,
+	"Meter":              true,
+	"Propagators":        true,
+	"SpanStartOptions":   true,
+	"SpanNameFormatter":  true,
+	"TracerProvider":     true,
+	"MeterProvider":      true,
+	"CarrierFn":          true,
+	"BinaryTraceHeader":  true,
+	"BodyFieldLimit":     true,
+	"MetricAttributesFn": true,
+	"AsyncMetricsBuffer": true,
+}
+
+// onlyFastPathOptions reports whether c leaves nothing to do on a request but
+// extracting its trace context once its spans and metrics are known to be
+// dropped. Any other field set takes the instrumented path, so that options
+// with side effects on the request, its response or the middleware itself are
+// honored without having to be listed.
+func (c *config) onlyFastPathOptions() bool {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if !fastPathFields[v.Type().Field(i).Name] && !v.Field(i).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
 // WithTracerProvider specifies a tracer provider to use for creating a tracer.
 // If none is specified, the global provider is used.
 func WithTracerProvider(tp trace.TracerProvider) Option {
@@ -92,30 +231,81 @@ func WithPublicEndpointFn(fn func(r *http.Request) bool) Option {
 
 // WithPropagators configures specific propagators.
 // If this option isn't specified, then the global TextMapPropagator is used.
+// Passing nil disables propagation: no trace context is extracted.
 func WithPropagators(ps propagation.TextMapPropagator) Option {
 	return func(c *config) {
 		c.Propagators = ps
 	}
 }
 
+// WithPropagationCarrier sets the function returning the carrier the trace
+// context is extracted from. This allows extracting context that a client
+// passes in query parameters or elsewhere instead of headers.
+// If this option isn't specified, the request headers are used.
+func WithPropagationCarrier(fn func(r *http.Request) propagation.TextMapCarrier) Option {
+	return func(c *config) {
+		c.CarrierFn = fn
+	}
+}
+
 // WithSpanOptions configures an additional set of trace.SpanStartOption,
-// which are applied to each new span.
+// which are applied to each new span. They are applied before the options
+// computed from the request, so an attribute recorded by the middleware takes
+// precedence over one with the same key, and before those returned by the
+// WithSpanStartOptionsFn function.
 func WithSpanOptions(opts ...trace.SpanStartOption) Option {
 	return func(c *config) {
 		c.SpanStartOptions = append(c.SpanStartOptions, opts...)
 	}
 }
 
+// WithSpanStartOptionsFn takes a function that is called on every request after
+// the trace context was extracted and before the span is started. The returned
+// options are applied to the span, so attributes set this way are visible to
+// the sampler. Unlike WithSpanOptions, fn can derive options from the extracted
+// context, e.g. from baggage.
+func WithSpanStartOptionsFn(fn func(ctx context.Context, r *http.Request) []trace.SpanStartOption) Option {
+	return func(c *config) {
+		c.SpanStartOptionsFn = fn
+	}
+}
+
 // WithFilter adds a filter to the list of filters used by the handler.
 // If any filter indicates to exclude a request, then the request will not be traced.
 // All filters must allow a request to be traced for a Span to be created.
 // If no filters are provided, then all requests are traced.
+//
+// Excluded requests are still served by the wrapped handler, only their span
+// and metrics are skipped. Filters do not reject requests.
 func WithFilter(f Filter) Option {
 	return func(c *config) {
 		c.Filters = append(c.Filters, f)
 	}
 }
 
+// WithTraceFilter adds a filter deciding whether a request is traced. Unlike
+// WithFilter, metrics are still recorded for the requests it excludes, along
+// with the attributes the handler adds to the Labeler of the request context,
+// and it is called with the trace context extracted from the request.
+func WithTraceFilter(f Filter) Option {
+	return func(c *config) {
+		c.TraceFilters = append(c.TraceFilters, f)
+	}
+}
+
+// WithTracedMethods only traces the requests with one of the given methods,
+// e.g. the mutating ones. Metrics are still recorded for all methods.
+func WithTracedMethods(methods ...string) Option {
+	traced := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		traced[strings.ToUpper(method)] = struct{}{}
+	}
+	return WithTraceFilter(func(r *http.Request) bool {
+		_, ok := traced[r.Method]
+		return ok
+	})
+}
+
 // WithSpanNameFormatter takes a function that will be called on every
 // request, and the returned string will become the Span Name.
 func WithSpanNameFormatter(fn func(operation string, r *http.Request) string) Option {
@@ -147,3 +337,844 @@ func WithMetricAttributesFn(metricAttributesFn func(r *http.Request) []attribute
 		c.MetricAttributesFn = metricAttributesFn
 	}
 }
+
+// WithDiagnosticAttributes records attributes describing how the middleware
+// itself was configured, such as the static operation passed to NewMiddleware
+// (as http.operation_configured). Comparing it with http.route shows whether
+// the operation string is meaningful for the instrumented routes.
+func WithDiagnosticAttributes() Option {
+	return func(c *config) {
+		c.DiagnosticAttrs = true
+	}
+}
+
+// WithBodyChecksum records a SHA-256 checksum of the request body as
+// http.request.body.checksum, which helps debugging duplicate submissions
+// to APIs that deduplicate by body hash. The body is hashed while the handler
+// reads it, so only the bytes actually read are covered and nothing is buffered.
+func WithBodyChecksum() Option {
+	return func(c *config) {
+		c.BodyChecksum = true
+	}
+}
+
+// WithResourceAttributes adds static attributes, such as deployment.environment
+// or a region, to every span and metric recorded by the middleware. It is a
+// lightweight alternative to configuring a resource.Resource on the providers.
+// The attributes are constant and thus safe to use as metric dimensions.
+func WithResourceAttributes(attrs ...attribute.KeyValue) Option {
+	return func(c *config) {
+		c.ResourceAttributes = append(c.ResourceAttributes, attrs...)
+	}
+}
+
+// WithRetryAttemptHeader records the retry attempt number sent by clients in
+// the named request header (e.g. X-Retry-Attempt) as http.request.retry_attempt.
+// Missing, non-numeric or negative values are ignored.
+func WithRetryAttemptHeader(name string) Option {
+	return func(c *config) {
+		c.RetryAttemptHeader = name
+	}
+}
+
+// WithDecodeRequestSize records the decompressed size of request bodies sent
+// with a gzip or deflate Content-Encoding as http.request.body.uncompressed_size,
+// next to the wire size in http.request.body.size. The bytes are decompressed
+// on the side while the handler reads them; the handler still receives the
+// compressed body unchanged. Decompression stops after 64 MiB, the size of a
+// body decompressing to more, e.g. a compression bomb, is not recorded.
+func WithDecodeRequestSize() Option {
+	return func(c *config) {
+		c.DecodeRequestSize = true
+	}
+}
+
+// WithBodyFieldAttributes records the listed top-level fields of JSON request
+// bodies as span attributes named http.request.body.field.<name>. The body is
+// inspected before the handler runs and restored afterwards, so the handler
+// reads it intact. Only the bodies of requests with a JSON Content-Type, such
+// as application/json or application/merge-patch+json, are inspected, unless
+// their media type is excluded by WithoutBodyWrapForContentTypes. Bodies that
+// are not JSON objects or exceed the limit set by WithBodyFieldLimit are
+// ignored.
+func WithBodyFieldAttributes(fields ...string) Option {
+	return func(c *config) {
+		c.BodyFields = append(c.BodyFields, fields...)
+	}
+}
+
+// WithBodyFieldLimit sets the maximum number of body bytes inspected by
+// WithBodyFieldAttributes. It defaults to 64KiB.
+func WithBodyFieldLimit(n int) Option {
+	return func(c *config) {
+		c.BodyFieldLimit = n
+	}
+}
+
+// WithStatusWriteEvent adds a response.status_written span event carrying
+// http.response.status_code at the moment the handler writes the response
+// status, pinning it in the span timeline relative to reads and writes.
+func WithStatusWriteEvent() Option {
+	return func(c *config) {
+		c.StatusWriteEvent = true
+	}
+}
+
+// WithRequestContentTypeAttribute records the media type of the request
+// Content-Type header, without parameters such as charset, as
+// http.request.content_type on spans. Since clients may send any media type,
+// it is only recorded on metrics when metricTypes are given, typically the
+// MIME types of the marshalers registered on the runtime.ServeMux: media types
+// outside of them are recorded as other.
+func WithRequestContentTypeAttribute(metricTypes ...string) Option {
+	return func(c *config) {
+		c.RequestContentType = true
+		c.ContentTypeMetricTypes = append(c.ContentTypeMetricTypes, metricTypes...)
+	}
+}
+
+// WithMetricAttributeAllowlist restricts the attributes added to metrics by a
+// Labeler or the MetricAttributesFn to the given keys; all others are dropped.
+// This protects metric backends from a single callback returning high
+// cardinality values. Attributes the middleware adds itself are not affected.
+func WithMetricAttributeAllowlist(keys ...string) Option {
+	return func(c *config) {
+		c.MetricAttributeAllowlist = append(c.MetricAttributeAllowlist, keys...)
+	}
+}
+
+// WithMethodOverrideHeader makes the span's http.request.method reflect the
+// effective method clients tunnel through POST in the named header, usually
+// X-HTTP-Method-Override. The method used on the wire is then recorded as
+// http.request.method_original. Unknown override methods are ignored.
+func WithMethodOverrideHeader(name string) Option {
+	return func(c *config) {
+		c.MethodOverrideHeader = name
+	}
+}
+
+// WithDrainRequestBody makes the middleware read and discard up to maxBytes of
+// the request body left unread by the handler, and close it, once the handler
+// returns. The drained bytes are included in the recorded request size, and a
+// fully drained body allows the connection to be reused.
+func WithDrainRequestBody(maxBytes int) Option {
+	return func(c *config) {
+		c.DrainRequestBody = maxBytes
+	}
+}
+
+// WithCorrelationLinkHeader adds a span link to the trace referenced by the
+// named request header, for systems that propagate a related trace out of band.
+// The header holds a hex trace ID followed by "-" or ":" and a hex span ID,
+// e.g. "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7". Malformed values,
+// and values without a span ID or with an all-zero one, are ignored since a
+// link needs a valid span context.
+func WithCorrelationLinkHeader(name string) Option {
+	return func(c *config) {
+		c.CorrelationLinkHeader = name
+	}
+}
+
+// WithCacheStatusHeader records the cache status reported in the named response
+// header, usually X-Cache, as http.response.cache_status on spans and metrics.
+// Only the first token of the value is kept, upper-cased, so that values like
+// "HIT from proxy" stay low-cardinality.
+func WithCacheStatusHeader(name string) Option {
+	return func(c *config) {
+		c.CacheStatusHeader = name
+	}
+}
+
+// WithPatternObserver takes a function reporting which grpc-gateway pattern
+// matched a request, e.g. its index in the registration order, which the
+// middleware cannot see by itself. When fn returns true, the pattern is
+// recorded as gateway.pattern. This is lower level than http.route and meant
+// for debugging routing.
+func WithPatternObserver(fn func(r *http.Request, pathParams map[string]string) (pattern string, ok bool)) Option {
+	return func(c *config) {
+		c.PatternObserver = fn
+	}
+}
+
+// WithErrorOnlyAttributesFn takes a function returning span attributes that are
+// only worth recording when a request failed. It is called with the response
+// status code once the handler returned, and only if the span status is set to
+// error, i.e. for 5xx and invalid status codes. This keeps successful spans lean
+// while capturing rich debug information on failures.
+func WithErrorOnlyAttributesFn(fn func(r *http.Request, statusCode int) []attribute.KeyValue) Option {
+	return func(c *config) {
+		c.ErrorOnlyAttributesFn = fn
+	}
+}
+
+// WithEnduserExtractor takes a function returning the authenticated principal
+// that upstream auth middleware stored in the request context. When it returns
+// true, the non-empty id and role are recorded as enduser.id and enduser.role.
+// Nothing identifying the end user is recorded unless this option is used.
+func WithEnduserExtractor(fn func(ctx context.Context) (id, role string, ok bool)) Option {
+	return func(c *config) {
+		c.EnduserExtractor = fn
+	}
+}
+
+// WithMetricNamer takes a function returning the name each metric instrument
+// is created under given its default semantic convention name, e.g.
+// "http.server.request.duration". It allows following an internal naming
+// scheme without renaming the metrics in the collector.
+func WithMetricNamer(fn func(defaultName string) string) Option {
+	return func(c *config) {
+		c.MetricNamer = fn
+	}
+}
+
+// WithMetricNamePrefix creates all metric instruments under their default
+// name prefixed with prefix. It is a shorthand for WithMetricNamer.
+func WithMetricNamePrefix(prefix string) Option {
+	return WithMetricNamer(func(name string) string {
+		return prefix + name
+	})
+}
+
+// WithTimestampAttributes records the wall-clock time the request started and
+// the response ended, in nanoseconds since the Unix epoch, as span attributes.
+// It eases joining spans to logs that only carry timestamps.
+func WithTimestampAttributes() Option {
+	return func(c *config) {
+		c.TimestampAttrs = true
+	}
+}
+
+// WithBackendResolver takes a function returning the address of the gRPC
+// backend a request is forwarded to, e.g. the target of the grpc.ClientConn
+// registered for its path. A non-empty address is recorded as
+// server.socket.address to debug routing across multiple backends.
+func WithBackendResolver(fn func(r *http.Request, pathParams map[string]string) string) Option {
+	return func(c *config) {
+		c.BackendResolver = fn
+	}
+}
+
+// WithLatencyBuckets records whether a request was fast, normal or slow as the
+// http.server.latency_bucket span attribute. Requests taking less than fast
+// are fast, those taking slow or more are slow, and all others are normal.
+func WithLatencyBuckets(fast, slow time.Duration) Option {
+	return func(c *config) {
+		c.LatencyBuckets = true
+		c.LatencyFast = fast
+		c.LatencySlow = slow
+	}
+}
+
+// WithBinaryTraceHeader extracts the span context from the named request
+// header in the base64-encoded binary format of gRPC's grpc-trace-bin, in
+// addition to the configured propagators. When both are present, the span
+// context extracted by the propagators takes precedence.
+func WithBinaryTraceHeader(name string) Option {
+	return func(c *config) {
+		c.BinaryTraceHeader = name
+	}
+}
+
+// WithMaxBodyEvents caps the number of read and write events added to the span
+// of a request to n. A single events.truncated event marks where subsequent
+// events were dropped, keeping the spans of streaming uploads bounded.
+func WithMaxBodyEvents(n int) Option {
+	return func(c *config) {
+		c.MaxBodyEvents = n
+	}
+}
+
+// WithSamplingDecisionAttribute records whether the span was sampled as the
+// otel.sampled attribute. It only shows on spans recorded without being
+// sampled, e.g. by a sampler returning RecordOnly, and on the exported spans,
+// which helps diagnosing spans missing from the backend.
+func WithSamplingDecisionAttribute() Option {
+	return func(c *config) {
+		c.SamplingDecisionAttr = true
+	}
+}
+
+// WithSpanNameTemplate names spans after tmpl, in which the placeholders
+// {method}, {route}, {operation} and {param.<name>} are replaced with the
+// request method, the matched grpc-gateway route, the configured operation
+// and the named path parameter, e.g. "{method} {route}". It takes precedence
+// over WithSpanNameFormatter.
+func WithSpanNameTemplate(tmpl string) Option {
+	return func(c *config) {
+		c.SpanNameTemplate = tmpl
+	}
+}
+
+// WithSchemeResolver takes a function returning the scheme a request was sent
+// with by the client, "http" or "https", recorded as url.scheme. By default the
+// X-Forwarded-Proto header set by TLS-terminating proxies is used when present,
+// falling back to whether the request was received over TLS.
+func WithSchemeResolver(fn func(r *http.Request) string) Option {
+	return func(c *config) {
+		c.SchemeResolver = fn
+	}
+}
+
+// WithSelfStats keeps counters of the requests seen by the middleware, exposed
+// by Middleware.Stats and Middleware.DebugHandler. They help checking that the
+// middleware is installed and its filters behave as expected.
+func WithSelfStats() Option {
+	return func(c *config) {
+		c.SelfStats = true
+	}
+}
+
+// WithResponseBodyFieldAttributes records the listed top-level fields of JSON
+// response bodies, e.g. a server-generated "resource_id", as span attributes
+// prefixed with "http.response.body.field.". The response is copied as it is
+// written, leaving what the client receives unchanged. Bodies larger than
+// WithBodyFieldLimit are ignored.
+func WithResponseBodyFieldAttributes(fields ...string) Option {
+	return func(c *config) {
+		c.ResponseBodyFields = append(c.ResponseBodyFields, fields...)
+	}
+}
+
+// WithPathParamCount records the number of path parameters the request matched
+// as http.route.param_count, telling collection routes from item routes
+// without recording the parameter values.
+func WithPathParamCount() Option {
+	return func(c *config) {
+		c.PathParamCount = true
+	}
+}
+
+// WithTrustedProxyCount sets the number of addresses appended to the end of
+// the X-Forwarded-For header by trusted proxies. The client.address is then
+// the entry right before them instead of the leftmost one, which any client
+// can forge. When the header has no more entries than n, the leftmost one is
+// used.
+func WithTrustedProxyCount(n int) Option {
+	return func(c *config) {
+		c.TrustedProxyCount = n
+	}
+}
+
+// WithSNIServerAddress records the server name sent by the client in the TLS
+// handshake as server.address, which identifies the requested virtual host of
+// multi-tenant TLS gateways better than the Host header. Requests received
+// without TLS or SNI keep using the server name or the Host header. Since the
+// client chooses it, the server name is only recorded on spans, metrics keep
+// the server name or the Host header.
+func WithSNIServerAddress() Option {
+	return func(c *config) {
+		c.SNIServerAddress = true
+	}
+}
+
+// WithoutUnmatchedRouteTracing marks the span of requests answered with 404
+// Not Found for which neither a route nor any path parameters are known, e.g.
+// by a catch-all handler, with http.route.unmatched set to true, so that
+// scanners and probes can be dropped from traces by the span pipeline, e.g. a
+// filtering exporter or collector processor, and only show in the metrics. As
+// the status is only known once the handler returned, the span is still
+// started and ended as usual; requests answered otherwise are not affected.
+func WithoutUnmatchedRouteTracing() Option {
+	return func(c *config) {
+		c.DropUnmatchedRoutes = true
+	}
+}
+
+// WithAPIVersionExtractor records the API version a request targets as
+// http.api.version on the span and metrics. The version is returned by fn,
+// e.g. from a header, and must have a low cardinality; it is not recorded
+// when empty. If fn is nil, the first segment of the matched route template
+// made of a "v" followed by digits is used, e.g. "v2" for /v2/users/{id}.
+func WithAPIVersionExtractor(fn func(r *http.Request, pathParams map[string]string) string) Option {
+	return func(c *config) {
+		c.APIVersionAttr = true
+		c.APIVersionExtractor = fn
+	}
+}
+
+// WithRateLimitHeaders records the numeric values of the named response
+// headers, e.g. "X-RateLimit-Limit", "X-RateLimit-Remaining" and
+// "X-RateLimit-Reset", as the http.response.rate_limit.limit, .remaining and
+// .reset span attributes. An empty name skips the corresponding attribute.
+func WithRateLimitHeaders(limit, remaining, reset string) Option {
+	return func(c *config) {
+		c.RateLimitHeaders = [3]string{limit, remaining, reset}
+	}
+}
+
+// WithClientCertAttributes records the subject common name and the serial
+// number of the leaf certificate presented by mTLS clients, for audit traces.
+// Nothing is recorded for requests received without a client certificate.
+func WithClientCertAttributes() Option {
+	return func(c *config) {
+		c.ClientCertAttrs = true
+	}
+}
+
+// WithFilterPanicPolicy sets whether a request is instrumented when one of the
+// filters panics while deciding on it. The panic is recovered and reported to
+// the OpenTelemetry error handler, and a filter.panic event is added to the
+// span when there is one. It defaults to FilterPanicAllow.
+func WithFilterPanicPolicy(policy FilterPanicPolicy) Option {
+	return func(c *config) {
+		c.FilterPanicPolicy = policy
+	}
+}
+
+// WithOperationGroupFn takes a function returning the logical operation group
+// a request belongs to, e.g. "checkout" or "catalog". A non-empty group is
+// recorded as http.operation.group on the span and metrics, aggregating many
+// routes under a handful of groups.
+func WithOperationGroupFn(fn func(r *http.Request, pathParams map[string]string) string) Option {
+	return func(c *config) {
+		c.OperationGroupFn = fn
+	}
+}
+
+// WithConcurrencySnapshot records the number of requests in flight in the
+// middleware and the number of goroutines on the span of requests taking
+// longer than threshold, hinting at the load a slow request was served under.
+func WithConcurrencySnapshot(threshold time.Duration) Option {
+	return func(c *config) {
+		c.ConcurrencySnapshot = threshold
+	}
+}
+
+// WithoutBodyWrapForContentTypes leaves the bodies of requests with one of the
+// given media types, e.g. "application/octet-stream", unwrapped, avoiding the
+// per-read overhead for large uploads. Their size is recorded from the
+// Content-Length header when known, and read events, checksums and the
+// decompressed size are not recorded for them. Response bodies are still
+// counted, as the response writer is needed to observe the status code.
+func WithoutBodyWrapForContentTypes(types ...string) Option {
+	return func(c *config) {
+		c.NoBodyWrapContentTypes = append(c.NoBodyWrapContentTypes, types...)
+	}
+}
+
+// WithPathParamEvents records the values of the listed path parameters as the
+// attributes of a single route.params span event, named with the
+// "route.param." prefix. This keeps routing debug information off the span
+// attributes used for querying. Parameters that are not listed are never
+// recorded.
+func WithPathParamEvents(params ...string) Option {
+	return func(c *config) {
+		c.PathParamEvents = append(c.PathParamEvents, params...)
+	}
+}
+
+// WithRecordEOFErrors records the errors reading the request body and writing
+// the response as the http.read_error and http.write_error span attributes,
+// including io.EOF, which is otherwise never recorded. This helps debugging
+// prematurely closed bodies.
+func WithRecordEOFErrors() Option {
+	return func(c *config) {
+		c.RecordEOFErrors = true
+	}
+}
+
+// WithRouteResolver takes a function returning the route template a request
+// matched, recorded as http.route. By default, the path template of the
+// grpc-gateway pattern is used, which is only known to requests dispatched by
+// a runtime.ServeMux.
+func WithRouteResolver(fn func(r *http.Request) string) Option {
+	return func(c *config) {
+		c.RouteResolver = fn
+	}
+}
+
+// WithOperationFromRoute uses the route resolved for each request, see
+// WithRouteResolver, in place of the static operation the middleware was
+// created with to name spans. The static operation is still used for the
+// requests without a resolved route.
+func WithOperationFromRoute() Option {
+	return func(c *config) {
+		c.OperationFromRoute = true
+	}
+}
+
+// WithResponsePropagation injects the span context of each request into the
+// response headers with p before the handler is called, e.g. to echo a
+// traceparent header back to clients.
+func WithResponsePropagation(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.ResponsePropagator = p
+	}
+}
+
+// WithTenantExtractor takes a function returning the logical tenant of a
+// request, e.g. from its subdomain, a header or a claim set by an upstream
+// authentication layer. A non-empty tenant is recorded as tenant.id on the
+// span and metrics. To bound the cardinality of metrics, the tenants seen
+// after the first 100 distinct ones are recorded on metrics as "_other".
+func WithTenantExtractor(fn func(r *http.Request) string) Option {
+	return func(c *config) {
+		c.TenantExtractor = fn
+	}
+}
+
+// WithNanosecondDurationAttribute records the duration of the request in
+// nanoseconds as the http.server.request.duration_ns span attribute. It is the
+// same duration the http.server.request.duration metric records, without the
+// precision lost by histogram buckets.
+func WithNanosecondDurationAttribute() Option {
+	return func(c *config) {
+		c.NanosecondDurationAttr = true
+	}
+}
+
+// WithMetricsFollowSampling only records the metrics of requests whose span is
+// sampled, keeping metrics consistent with traces in pipelines deriving one
+// from the other. Requests excluded by a trace filter, see WithTraceFilter, or
+// served while the tracing circuit breaker is open are not recorded either,
+// even under a sampled parent span. By default, the metrics of
+// every instrumented request are recorded.
+func WithMetricsFollowSampling() Option {
+	return func(c *config) {
+		c.MetricsFollowSampling = true
+	}
+}
+
+// WithLanguageAttribute records the language the client prefers most in its
+// Accept-Language header, e.g. fr-CA for "fr-CA,fr;q=0.9,en;q=0.8", as the
+// http.request.language span attribute. The wildcard "*" is never recorded.
+func WithLanguageAttribute() Option {
+	return func(c *config) {
+		c.LanguageAttr = true
+	}
+}
+
+// WithFixedServerPort records port as server.port instead of the port of the
+// server name or Host header, which may be the port of a proxy in front of the
+// server. Combined with WithServerName, the Host header is no longer parsed.
+// As for any port, the default port of the scheme is not recorded.
+func WithFixedServerPort(port int) Option {
+	return func(c *config) {
+		c.FixedServerPort = port
+	}
+}
+
+// WithHTTP2StreamAttribute takes a function returning the ID of the HTTP/2
+// stream a request was received on, recorded as http2.stream_id when it returns
+// true. net/http does not expose stream IDs, so fn is only useful to servers
+// tracking them on their own, e.g. in the request context.
+func WithHTTP2StreamAttribute(fn func(r *http.Request) (uint32, bool)) Option {
+	return func(c *config) {
+		c.HTTP2StreamID = fn
+	}
+}
+
+// WithTraceStateFn takes a function returning the trace state the span of a
+// request is started with, from the trace state extracted from the request.
+// It can be used to add vendor entries propagated to downstream services. As
+// TraceState.Insert fails on invalid entries, fn should return the extracted
+// trace state when it does.
+func WithTraceStateFn(fn func(r *http.Request, ts trace.TraceState) trace.TraceState) Option {
+	return func(c *config) {
+		c.TraceStateFn = fn
+	}
+}
+
+// WithOriginAttribute records the Origin header of cross-origin requests as
+// http.request.origin on the span and metrics. Origins are compared with
+// allowlist case-insensitively and recorded as spelled in allowlist; the others
+// are recorded as "other" to keep the attribute low-cardinality.
+func WithOriginAttribute(allowlist ...string) Option {
+	return func(c *config) {
+		c.OriginAllowlist = append(c.OriginAllowlist, allowlist...)
+		if c.OriginAllowlist == nil {
+			// Origins are still recorded, as other, with an empty allowlist.
+			c.OriginAllowlist = []string{}
+		}
+	}
+}
+
+// WithResponseCompressionAttribute records whether the handler compressed the
+// response, i.e. set a Content-Encoding response header other than identity,
+// as http.response.compressed on the span and metrics.
+func WithResponseCompressionAttribute() Option {
+	return func(c *config) {
+		c.ResponseCompressedAttr = true
+	}
+}
+
+// WithTransactionIDExtractor takes a function returning the business
+// transaction ID of a request, e.g. an order ID, recorded as transaction.id
+// when it returns true. It is called once the request is handled, with the
+// response headers, so that the ID can be taken from the request or response.
+func WithTransactionIDExtractor(fn func(r *http.Request, respHeader http.Header) (string, bool)) Option {
+	return func(c *config) {
+		c.TransactionIDExtractor = fn
+	}
+}
+
+// WithTracingCircuitBreaker pauses tracing for cooldown after threshold
+// consecutive span export failures, which are reported to the middleware with
+// Middleware.ReportExportResult. While tracing is paused, requests are served
+// with a non-recording span propagating the extracted span context, and their
+// metrics are still recorded.
+func WithTracingCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *config) {
+		c.BreakerThreshold = threshold
+		c.BreakerCooldown = cooldown
+	}
+}
+
+// WithRangeAttributes records the Range request header and the Content-Range
+// response header, when present, as the http.request.range and
+// http.response.content_range span attributes, to debug partial content
+// responses.
+func WithRangeAttributes() Option {
+	return func(c *config) {
+		c.RangeAttrs = true
+	}
+}
+
+// WithFullURLAttribute records the full URL of the request as url.full on the
+// span. As URLs may carry credentials, the user info is always removed and the
+// values of the query parameters AWSAccessKeyId, Signature, sig and
+// X-Goog-Signature, and of redactedParams, are replaced with REDACTED.
+// Parameter names are compared case-insensitively.
+func WithFullURLAttribute(redactedParams ...string) Option {
+	return func(c *config) {
+		c.FullURLAttr = true
+		c.RedactedQueryParams = append(c.RedactedQueryParams, redactedParams...)
+	}
+}
+
+// WithCustomVerbResolver takes a function returning the custom method verb a
+// request is bound to, e.g. batchGet for the "/v1/books:batchGet" path of a
+// grpc-gateway binding, recorded as rpc.method when it is not empty.
+func WithCustomVerbResolver(fn func(r *http.Request) string) Option {
+	return func(c *config) {
+		c.CustomVerbResolver = fn
+	}
+}
+
+// WithHighLoadAttributeReduction drops the optional metric attributes, i.e.
+// those added with a Labeler, WithMetricAttributesFn or another option, while
+// more than threshold requests are in flight in the middleware. Only the
+// attributes required by the semantic conventions, such as the method and
+// status code, are then recorded, reducing the cost of recording under load.
+// Span attributes are not affected.
+func WithHighLoadAttributeReduction(threshold int) Option {
+	return func(c *config) {
+		c.HighLoadThreshold = threshold
+	}
+}
+
+// WithBodyCloseEvent adds a request.body.closed span event, with the number of
+// bytes read from the request body as http.read_bytes, when the handler closes
+// the request body. A missing event tells the body was never closed by the
+// handler, and the bytes read one that it was closed early. Closing the body
+// once the handler returned, e.g. from a goroutine it started, adds no event
+// since the span has ended by then.
+func WithBodyCloseEvent() Option {
+	return func(c *config) {
+		c.BodyCloseEvent = true
+	}
+}
+
+// WithInstanceAttributes records the host name and process ID of the server as
+// the host.name and process.pid span attributes, to tell which instance of a
+// fleet served a request without configuring a resource. Both are looked up
+// once, when the middleware is created.
+func WithInstanceAttributes() Option {
+	return func(c *config) {
+		c.InstanceAttrs = true
+	}
+}
+
+// WithDeadlinePropagationAttribute records whether grpc-gateway propagates a
+// deadline to the gRPC backend of a request as rpc.grpc.deadline_propagated,
+// and the propagated timeout, in milliseconds, as
+// rpc.grpc.propagated_timeout_ms. The timeout is the earliest of the request
+// context deadline and the Grpc-Timeout header, as computed by grpc-gateway.
+func WithDeadlinePropagationAttribute() Option {
+	return func(c *config) {
+		c.DeadlinePropagationAttrs = true
+	}
+}
+
+// WithCombinedProtocolAttribute records the transport security and protocol
+// version of the request as the single http.request.proto attribute on the span
+// and metrics: h2c or h2 for HTTP/2 without or with TLS, h3 for HTTP/3, and
+// e.g. http1.1 or https1.1 for HTTP/1.x.
+func WithCombinedProtocolAttribute() Option {
+	return func(c *config) {
+		c.CombinedProtocolAttr = true
+	}
+}
+
+// WithIdempotencyKeyHeader records the idempotency key sent by clients in the
+// named request header, Idempotency-Key if name is empty, as
+// http.request.idempotency_key, to correlate retries with the original
+// request. As keys are unique, the attribute is only recorded on the span.
+func WithIdempotencyKeyHeader(name string) Option {
+	if name == "" {
+		name = "Idempotency-Key"
+	}
+	return func(c *config) {
+		c.IdempotencyKeyHeader = name
+	}
+}
+
+// WithSkipIfAlreadyInstrumented serves the requests whose context is marked
+// with ContextWithInstrumented, e.g. by an outer middleware when middleware are
+// nested, without instrumenting them again. This avoids duplicate spans and
+// metrics when a global middleware and a route group one are chained.
+func WithSkipIfAlreadyInstrumented() Option {
+	return func(c *config) {
+		c.SkipIfInstrumented = true
+	}
+}
+
+// WithCacheValidatorAttributes records the ETag and Last-Modified response
+// headers, when present, as the http.response.etag and
+// http.response.last_modified span attributes, to debug conditional requests.
+func WithCacheValidatorAttributes() Option {
+	return func(c *config) {
+		c.CacheValidatorAttrs = true
+	}
+}
+
+// WithConditionalRequestAttributes records whether the request is conditional,
+// i.e. has an If-None-Match or If-Modified-Since header, as
+// http.request.conditional on the span and metrics. Along with the response
+// status code, e.g. 304 or 200, it tells the cache hit ratio of clients.
+func WithConditionalRequestAttributes() Option {
+	return func(c *config) {
+		c.ConditionalRequestAttr = true
+	}
+}
+
+// WithFlushCountAttribute records the number of times the handler flushed the
+// response as http.response.flush_count, to tell how a streamed response was
+// split.
+func WithFlushCountAttribute() Option {
+	return func(c *config) {
+		c.FlushCountAttr = true
+	}
+}
+
+// WithHeaderSizeAttributes records the number of request header fields as
+// http.request.header.count and their approximate size on the wire, in bytes,
+// as http.request.header.size. Abnormally large headers may tell an attack or
+// a misbehaving client.
+func WithHeaderSizeAttributes() Option {
+	return func(c *config) {
+		c.HeaderSizeAttrs = true
+	}
+}
+
+// WithAsyncMetrics records the metrics of requests on a background goroutine,
+// off the request path, through a queue holding up to bufferSize requests.
+// When the queue is full, the metrics of a request are dropped and counted by
+// the otelgrpcgw.metrics.dropped counter, as are those of requests served after
+// Middleware.Close, which records the queued metrics and must be called when
+// the middleware is discarded. The option only applies to New: NewHandler and
+// NewMiddleware, which cannot be closed, record metrics inline.
+func WithAsyncMetrics(bufferSize int) Option {
+	return func(c *config) {
+		c.AsyncMetricsBuffer = bufferSize
+	}
+}
+
+// WithGeoHeader records the country code a CDN sets in the named request
+// header, e.g. CF-IPCountry or X-Geo-Country, as client.geo.country on the span
+// and metrics. Only two-character codes are recorded, upper-cased, so that a
+// forged header cannot raise the cardinality of metrics.
+func WithGeoHeader(name string) Option {
+	return func(c *config) {
+		c.GeoHeader = name
+	}
+}
+
+// WithAuthSchemeAttribute records the authentication scheme of the request,
+// the first token of the Authorization header such as Bearer or Basic, as
+// http.request.auth_scheme on the span. The credentials are never recorded: a
+// header without a scheme followed by a space is ignored.
+func WithAuthSchemeAttribute() Option {
+	return func(c *config) {
+		c.AuthSchemeAttr = true
+	}
+}
+
+// WithResponseSizeBuckets records whether the response body was small,
+// medium, large or xlarge as http.response.size_bucket on the span and
+// metrics. Up to three thresholds in bytes, in any order, separate the buckets:
+// responses smaller than the smallest are small, those smaller than the next
+// are medium and so on. With fewer thresholds only the first buckets are used,
+// without any 1 KiB, 64 KiB and 1 MiB are used. Thresholds past the three
+// smallest are ignored and reported to the otel error handler.
+func WithResponseSizeBuckets(thresholds ...int) Option {
+	return func(c *config) {
+		if len(thresholds) == 0 {
+			thresholds = []int{1 << 10, 64 << 10, 1 << 20}
+		}
+		c.ResponseSizeBuckets = thresholds
+	}
+}
+
+// WithOutboundContentTypeAttribute records the Content-Type of the response,
+// as negotiated by the gateway's marshalers or set by the handler, as
+// gateway.outbound_content_type on the span. Comparing it with the Accept
+// header of the request helps to debug content negotiation.
+func WithOutboundContentTypeAttribute() Option {
+	return func(c *config) {
+		c.OutboundContentTypeAttr = true
+	}
+}
+
+// WithJWTClaimAttributes records the claims of the validated token at the given
+// paths, e.g. "sub", "scope" or "realm_access.roles", as span attributes
+// prefixed with jwt.claim.. Nested claims are selected with dot-separated
+// paths. The claims are returned by the function set with WithClaimsExtractor,
+// without it nothing is recorded. The token itself is never read.
+func WithJWTClaimAttributes(claimPaths ...string) Option {
+	return func(c *config) {
+		c.JWTClaimPaths = append(c.JWTClaimPaths, claimPaths...)
+	}
+}
+
+// WithClaimsExtractor takes a function returning the claims of the token
+// validated by an upstream middleware and stored in the request context, or
+// nil if the request is not authenticated. See WithJWTClaimAttributes.
+func WithClaimsExtractor(fn func(ctx context.Context) map[string]any) Option {
+	return func(c *config) {
+		c.ClaimsExtractor = fn
+	}
+}
+
+// WithPhaseEvents adds span events marking the phases of processing a request,
+// giving a timeline of where its latency is spent: extraction_done once the
+// trace context is extracted, handler_start and handler_done around the
+// wrapped handler, and metrics_recorded once the metrics are recorded.
+// metrics_recorded is not added when no metrics are recorded because of
+// WithMetricsFollowSampling, nor when they are queued by WithAsyncMetrics,
+// since they are recorded or dropped after the span ends.
+func WithPhaseEvents() Option {
+	return func(c *config) {
+		c.PhaseEvents = true
+	}
+}
+
+// WithSamplingPriorityFn takes a function evaluated once the request is
+// handled, with its status code and duration, whose result is recorded as the
+// sampling.priority span attribute. Tail-based samplers reading it can keep
+// the traces of interesting requests, e.g. by returning a higher priority for
+// errors and slow requests.
+func WithSamplingPriorityFn(fn func(r *http.Request, statusCode int, elapsed time.Duration) int) Option {
+	return func(c *config) {
+		c.SamplingPriorityFn = fn
+	}
+}
+
+// WithVaryAttribute records the Vary response header set by the handler as
+// the http.response.vary span attribute, to debug the cache keys of
+// downstream caches. Multiple Vary headers are joined with commas.
+func WithVaryAttribute() Option {
+	return func(c *config) {
+		c.VaryAttr = true
+	}
+}
@@ -0,0 +1,67 @@
+package otelgrpcgw
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+// grpcTimeoutHeader is the request header grpc-gateway reads the timeout of
+// the gRPC call from.
+const grpcTimeoutHeader = "Grpc-Timeout"
+
+// propagatedTimeout returns the timeout grpc-gateway propagates to the backend
+// for a request handled with ctx: the earliest of the deadline of ctx and the
+// Grpc-Timeout header, or runtime.DefaultContextTimeout when the header is not
+// set. It returns false when no deadline is propagated.
+func propagatedTimeout(ctx context.Context, r *http.Request) (time.Duration, bool) {
+	timeout := runtime.DefaultContextTimeout
+	if v := r.Header.Get(grpcTimeoutHeader); v != "" {
+		var ok bool
+		if timeout, ok = parseGRPCTimeout(v); !ok {
+			// grpc-gateway rejects the request.
+			return 0, false
+		}
+	}
+
+	deadline, hasDeadline := ctx.Deadline()
+	switch {
+	case hasDeadline && (timeout <= 0 || time.Until(deadline) < timeout):
+		return time.Until(deadline), true
+	case timeout > 0:
+		return timeout, true
+	}
+	return 0, false
+}
+
+// parseGRPCTimeout parses a Grpc-Timeout header value, e.g. "100m".
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 {
+		return 0, false
+	}
+	var unit time.Duration
+	switch v[len(v)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return unit * time.Duration(n), true
+}
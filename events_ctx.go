@@ -0,0 +1,34 @@
+package otelgrpcgw
+
+import "context"
+
+type readEventsKey struct{}
+
+type writeEventsKey struct{}
+
+// ContextWithReadEvents returns a context that enables or disables read events
+// for the request it is attached to, overriding the middleware configuration.
+// It is meant to be used by earlier middleware, e.g. to turn events on when a
+// debug header is present.
+func ContextWithReadEvents(parent context.Context, enabled bool) context.Context {
+	return context.WithValue(parent, readEventsKey{}, enabled)
+}
+
+// ContextWithWriteEvents returns a context that enables or disables write
+// events for the request it is attached to, overriding the middleware
+// configuration.
+func ContextWithWriteEvents(parent context.Context, enabled bool) context.Context {
+	return context.WithValue(parent, writeEventsKey{}, enabled)
+}
+
+// eventsEnabled returns whether read and write events are enabled for a request
+// with the given context, falling back to the configured defaults.
+func eventsEnabled(ctx context.Context, read, write bool) (bool, bool) {
+	if v, ok := ctx.Value(readEventsKey{}).(bool); ok {
+		read = v
+	}
+	if v, ok := ctx.Value(writeEventsKey{}).(bool); ok {
+		write = v
+	}
+	return read, write
+}
@@ -0,0 +1,93 @@
+package otelgrpcgw
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// FilterPanicPolicy tells whether a request is instrumented when a Filter
+// panics while deciding on it, see WithFilterPanicPolicy.
+type FilterPanicPolicy int
+
+const (
+	// FilterPanicAllow instruments the request as if the filter allowed it.
+	FilterPanicAllow FilterPanicPolicy = iota
+	// FilterPanicDeny excludes the request as if the filter rejected it.
+	FilterPanicDeny
+)
+
+// requestIDHeader is the request header FilterSample falls back to when the
+// request context carries no trace ID.
+const requestIDHeader = "X-Request-Id"
+
+// FilterSample returns a Filter allowing about fraction of all requests to be
+// traced. The decision is derived from the trace ID of the request context, or
+// the X-Request-Id header when there is none, so that every hop sampling the
+// same fraction keeps the same requests. Requests carrying neither are sampled
+// at random.
+//
+// Installed with WithTraceFilter, the trace ID extracted from the incoming
+// request is used and metrics are still recorded for every request.
+func FilterSample(fraction float64) Filter {
+	if fraction >= 1 {
+		return func(*http.Request) bool { return true }
+	}
+	if !(fraction > 0) {
+		return func(*http.Request) bool { return false }
+	}
+
+	bound := uint64(fraction * math.MaxUint64)
+	return func(r *http.Request) bool {
+		var v uint64
+		if tid := trace.SpanContextFromContext(r.Context()).TraceID(); tid.IsValid() {
+			v = hashID(tid[:])
+		} else if id := r.Header.Get(requestIDHeader); id != "" {
+			v = hashID([]byte(id))
+		} else {
+			v = rand.Uint64()
+		}
+		return v < bound
+	}
+}
+
+// FilterByPathRegexp returns a Filter excluding the requests whose URL path
+// matches re, e.g. static assets with `\.(js|css|png)$`.
+func FilterByPathRegexp(re *regexp.Regexp) Filter {
+	return func(r *http.Request) bool {
+		return !re.MatchString(r.URL.Path)
+	}
+}
+
+// FilterOnlyPathRegexp returns a Filter excluding the requests whose URL path
+// does not match re.
+func FilterOnlyPathRegexp(re *regexp.Regexp) Filter {
+	return func(r *http.Request) bool {
+		return re.MatchString(r.URL.Path)
+	}
+}
+
+func hashID(id []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(id)
+	return h.Sum64()
+}
+
+// callFilter returns whether f allows r. A panic in f is reported to the
+// OpenTelemetry error handler and returned, and the request is then allowed
+// or not according to the configured FilterPanicPolicy.
+func (m *handler) callFilter(f Filter, r *http.Request) (allowed bool, recovered any) {
+	defer func() {
+		if recovered = recover(); recovered != nil {
+			allowed = m.filterPanicPolicy != FilterPanicDeny
+			otel.Handle(fmt.Errorf("otelgrpcgw: filter panicked: %v", recovered))
+		}
+	}()
+	return f(r), nil
+}
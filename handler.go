@@ -1,15 +1,34 @@
 package otelgrpcgw
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	goruntime "runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/felixge/httpsnoop"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
+	semconvNew "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/status"
 
 	"github.com/crazyfrankie/otelgrpcgw/internal/request"
 	"github.com/crazyfrankie/otelgrpcgw/internal/semconv"
@@ -22,13 +41,27 @@ type Filter func(*http.Request) bool
 // ScopeName is the instrumentation scope name.
 const ScopeName = "github.com/crazyfrankie/otelgrpcgw"
 
+// routeCardinalityLimit bounds the number of distinct routes remembered to
+// report the http.server.route.cardinality gauge.
+const routeCardinalityLimit = 1000
+
+// maxDecodedRequestSize bounds the bytes decompressed to record the
+// uncompressed size of a request body, see WithDecodeRequestSize.
+const maxDecodedRequestSize = 64 << 20
+
+// nonRecordingTracer starts the spans of the requests excluded by a trace filter
+// or served while the tracing circuit breaker is open.
+var nonRecordingTracer = tracenoop.NewTracerProvider().Tracer(ScopeName)
+
 type handler struct {
 	operation string
 	server    string
 
 	tracer             trace.Tracer
 	propagators        propagation.TextMapPropagator
+	carrierFn          func(*http.Request) propagation.TextMapCarrier
 	spanStartOptions   []trace.SpanStartOption
+	spanStartOptionsFn func(context.Context, *http.Request) []trace.SpanStartOption
 	readEvent          bool
 	writeEvent         bool
 	filters            []Filter
@@ -36,7 +69,101 @@ type handler struct {
 	publicEndpoint     bool
 	publicEndpointFn   func(*http.Request) bool
 	metricAttributesFn func(*http.Request) []attribute.KeyValue
+	diagnosticAttrs    bool
+	bodyChecksum       bool
+	resourceAttributes []attribute.KeyValue
+	retryAttemptHeader string
+	decodeRequestSize  bool
+	bodyFields         []string
+	bodyFieldLimit     int
+	statusWriteEvent   bool
+	requestContentType bool
+	contentTypeMetrics map[string]struct{}
+	metricAllowlist    map[attribute.Key]struct{}
+	methodOverride     string
+	drainRequestBody   int64
+	correlationHeader  string
+	cacheStatusHeader  string
+	patternObserver    func(*http.Request, map[string]string) (string, bool)
+	errorOnlyAttrsFn   func(*http.Request, int) []attribute.KeyValue
+	enduserExtractor   func(context.Context) (string, string, bool)
+	timestampAttrs     bool
+	traceFilters       []Filter
+	backendResolver    func(*http.Request, map[string]string) string
+	latencyBuckets     bool
+	latencyFast        time.Duration
+	latencySlow        time.Duration
+	maxBodyEvents      int64
+	samplingDecision   bool
+	spanNameTemplate   spanNameTemplate
+	schemeResolver     func(*http.Request) string
+	stats              *selfStats
+	responseBodyFields []string
+	pathParamCount     bool
+	trustedProxyCount  int
+	sniServerAddress   bool
+	dropUnmatched      bool
+	apiVersionAttr     bool
+	apiVersion         func(*http.Request, map[string]string) string
+	rateLimitHeaders   [3]string
+	clientCertAttrs    bool
+	filterPanicPolicy  FilterPanicPolicy
+	operationGroupFn   func(*http.Request, map[string]string) string
+	concurrencySlow    time.Duration
+	noBodyWrapTypes    map[string]struct{}
+	pathParamEvents    []string
+	recordEOFErrors    bool
+	routeResolver      func(*http.Request) string
+	operationFromRoute bool
+	responsePropagator propagation.TextMapPropagator
+	tenantExtractor    func(*http.Request) string
+	tenants            *tenantSet
+	nanosDuration      bool
+	sampledMetrics     bool
+	languageAttr       bool
+	fixedServerPort    string
+	lastFixedServer    atomic.Pointer[fixedServer]
+	http2StreamID      func(*http.Request) (uint32, bool)
+	traceStateFn       func(*http.Request, trace.TraceState) trace.TraceState
+	origins            map[string]string
+	responseCompressed bool
+	transactionID      func(*http.Request, http.Header) (string, bool)
+	breaker            *circuitBreaker
+	rangeAttrs         bool
+	redactedParams     map[string]struct{}
+	customVerb         func(*http.Request) string
+	highLoadThreshold  int64
+	bodyCloseEvent     bool
+	instanceAttrs      []attribute.KeyValue
+	deadlineAttrs      bool
+	combinedProtocol   bool
+	idempotencyHeader  string
+	skipInstrumented   bool
+	cacheValidators    bool
+	conditionalAttr    bool
+	flushCount         bool
+	headerSizeAttrs    bool
+	asyncMetrics       *asyncMetrics
+	geoHeader          string
+	authSchemeAttr     bool
+	sizeBuckets        []int
+	outboundType       bool
+	claimPaths         []string
+	claimsExtractor    func(context.Context) map[string]any
+	phaseEvents        bool
+	samplingPriority   func(*http.Request, int, time.Duration) int
+	varyAttr           bool
 	semconv            semconv.HTTPServer
+	routeCardinality   *semconv.RouteCardinality
+	spanCounters       spanCounters
+
+	// inFlight is the number of requests being instrumented.
+	inFlight atomic.Int64
+
+	// fastPath is set when neither tracing nor metrics can record anything
+	// and no option needs more than the trace context to be extracted, in
+	// which case requests are handed to next with their context only.
+	fastPath bool
 }
 
 func defaultHandlerFormatter(operation string, _ *http.Request) string {
@@ -48,7 +175,21 @@ func NewHandler(next runtime.HandlerFunc, operation string, opts ...Option) runt
 }
 
 func NewMiddleware(operation string, opts ...Option) func(runtime.HandlerFunc) runtime.HandlerFunc {
-	h := handler{
+	// Nothing can Close the middleware, so WithAsyncMetrics is ignored rather
+	// than leaking its goroutine.
+	return New(operation, append(slices.Clip(opts), WithAsyncMetrics(0))...).Wrap
+}
+
+// Middleware instruments the grpc-gateway handlers it wraps. Unlike the func
+// returned by NewMiddleware, it also gives access to the state the middleware
+// keeps about itself.
+type Middleware struct {
+	h *handler
+}
+
+// New returns a Middleware configured by opts.
+func New(operation string, opts ...Option) *Middleware {
+	h := &handler{
 		operation: operation,
 	}
 
@@ -60,29 +201,270 @@ func NewMiddleware(operation string, opts ...Option) func(runtime.HandlerFunc) r
 	cfg := newConfig(append(defaultOpts, opts...)...)
 	h.configure(cfg)
 
-	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
-			h.serveHTTP(w, r, next, pathParams)
-		}
+	return &Middleware{h: h}
+}
+
+// Close unregisters the asynchronous instruments of the middleware from its
+// meter, so that they stop being reported, and records the metrics queued by
+// WithAsyncMetrics. It must be called when a middleware is discarded before its
+// meter provider, e.g. when middleware is re-created repeatedly. The middleware
+// must not be used after Close.
+func (m *Middleware) Close() error {
+	if m.h.asyncMetrics != nil {
+		m.h.asyncMetrics.close()
+	}
+	return m.h.routeCardinality.Unregister()
+}
+
+// Wrap returns next instrumented by the middleware. It is a runtime.Middleware.
+func (m *Middleware) Wrap(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		m.h.serveHTTP(w, r, next, pathParams)
 	}
 }
 
 // serveHTTP sets up tracing and calls the given next runtime.HandlerFunc with the span
 // context injected into the request context.
 func (m *handler) serveHTTP(w http.ResponseWriter, r *http.Request, next runtime.HandlerFunc, pathParams map[string]string) {
+	if m.fastPath {
+		// Nothing is recorded, but next sees the same context as when the
+		// request is instrumented, so that the extracted trace context still
+		// reaches the backend through the MetadataAnnotator.
+		ctx := m.propagators.Extract(r.Context(), m.carrier(r))
+		if _, found := LabelerFromContext(ctx); !found {
+			ctx = ContextWithLabeler(ctx, &Labeler{})
+		}
+		ctx, _ = handlerErrorFromContext(ctx)
+		next(w, r.WithContext(ContextWithInstrumented(ctx)), pathParams)
+		return
+	}
+	if m.skipInstrumented && IsInstrumented(r.Context()) {
+		next(w, r, pathParams)
+		return
+	}
+
 	reqStartTime := time.Now()
+	m.stats.addRequest()
+	m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
 	// filters
+	// filterPanics holds the values recovered from panicking filters.
+	var filterPanics []any
 	for _, f := range m.filters {
-		if !f(r) {
-			// Reject — short-circuit here
+		allowed, recovered := m.callFilter(f, r)
+		if recovered != nil {
+			filterPanics = append(filterPanics, recovered)
+		}
+		if !allowed {
+			m.stats.addFiltered()
+			m.spanCounters.suppressed.Add(r.Context(), 1)
+			// Excluded requests are still served, just not instrumented.
+			next(w, r, pathParams)
 			return
 		}
 	}
 
 	// extract ctx
-	ctx := m.propagators.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
-	opts := []trace.SpanStartOption{
-		trace.WithAttributes(m.semconv.RequestTraceAttrs(m.server, r, semconv.RequestTraceAttrsOpts{})...),
+	ctx := m.propagators.Extract(r.Context(), m.carrier(r))
+	if m.traceStateFn != nil {
+		sc := trace.SpanContextFromContext(ctx)
+		sc = sc.WithTraceState(m.traceStateFn(r, sc.TraceState()))
+		if sc.IsRemote() {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+		} else {
+			ctx = trace.ContextWithSpanContext(ctx, sc)
+		}
+	}
+	// extractedAt is when the extraction_done event happened, it is added
+	// once the span is started.
+	var extractedAt time.Time
+	if m.phaseEvents {
+		extractedAt = time.Now()
+	}
+	scheme := m.schemeResolver(r)
+	semconvReq := withScheme(r, scheme)
+	unixSocket := isUnixSocket(r)
+	if unixSocket && semconvReq.RemoteAddr == unnamedUnixAddr {
+		// The peer address is recorded from RemoteAddr, which is meaningless here.
+		r2 := *semconvReq
+		r2.RemoteAddr = ""
+		semconvReq = &r2
+	}
+	server := m.server
+	if server == "" && m.fixedServerPort != "" {
+		server = m.hostWithFixedPort(r.Host)
+	}
+	// spanServer is the server recorded on the span, the SNI sent by the
+	// client is kept off metrics where any name would become a new series.
+	spanServer := server
+	if m.sniServerAddress && r.TLS != nil && r.TLS.ServerName != "" {
+		spanServer = m.withFixedPort(r.TLS.ServerName)
+	}
+	var traceAttrsOpts semconv.RequestTraceAttrsOpts
+	if m.trustedProxyCount > 0 {
+		traceAttrsOpts.HTTPClientIP = forwardedClientIP(r.Header.Get("X-Forwarded-For"), m.trustedProxyCount)
+	}
+	opts := append([]trace.SpanStartOption(nil), m.spanStartOptions...)
+	opts = append(opts, trace.WithAttributes(m.semconv.RequestTraceAttrs(spanServer, semconvReq, traceAttrsOpts)...))
+	if unixSocket {
+		opts = append(opts, trace.WithAttributes(m.semconv.NetworkTransportAttr("unix")...))
+	}
+	if m.methodOverride != "" {
+		if override := strings.ToUpper(r.Header.Get(m.methodOverride)); isStandardMethod(override) && override != r.Method {
+			opts = append(opts, trace.WithAttributes(
+				semconvNew.HTTPRequestMethodKey.String(override),
+				semconvNew.HTTPRequestMethodOriginal(r.Method),
+			))
+		}
+	}
+	// http.route is only derived from r.Pattern by semconv, grpc-gateway keeps
+	// the matched pattern in the context instead.
+	route := m.routeResolver(r)
+	if route != "" && r.Pattern == "" {
+		opts = append(opts, trace.WithAttributes(m.semconv.Route(route)))
+	}
+	m.routeCardinality.Observe(route)
+	if m.pathParamCount {
+		opts = append(opts, trace.WithAttributes(PathParamCountKey.Int(len(pathParams))))
+	}
+	if m.patternObserver != nil {
+		if pattern, ok := m.patternObserver(r, pathParams); ok {
+			opts = append(opts, trace.WithAttributes(GatewayPatternKey.String(pattern)))
+		}
+	}
+	if m.backendResolver != nil {
+		if addr := m.backendResolver(r, pathParams); addr != "" {
+			opts = append(opts, trace.WithAttributes(BackendAddressKey.String(addr)))
+		}
+	}
+	if m.diagnosticAttrs {
+		opts = append(opts, trace.WithAttributes(OperationConfiguredKey.String(m.operation)))
+	}
+	if len(m.resourceAttributes) > 0 {
+		opts = append(opts, trace.WithAttributes(m.resourceAttributes...))
+	}
+	if len(m.instanceAttrs) > 0 {
+		opts = append(opts, trace.WithAttributes(m.instanceAttrs...))
+	}
+	if len(m.bodyFields) > 0 && isJSONMediaType(mediaType(r.Header.Get("Content-Type"))) && !m.skipBodyWrap(r) {
+		opts = append(opts, trace.WithAttributes(peekRequestBodyFields(r, m.bodyFields, m.bodyFieldLimit)...))
+	}
+	// metricAttrs collects the attributes recorded on both the span and metrics.
+	var metricAttrs []attribute.KeyValue
+	if m.requestContentType {
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			mt := mediaType(ct)
+			opts = append(opts, trace.WithAttributes(RequestContentTypeKey.String(mt)))
+			if m.contentTypeMetrics != nil {
+				if _, ok := m.contentTypeMetrics[mt]; !ok {
+					mt = "other"
+				}
+				metricAttrs = append(metricAttrs, RequestContentTypeKey.String(mt))
+			}
+		}
+	}
+	if m.apiVersionAttr {
+		// The route template is bounded, unlike the path sent by the client.
+		version := routeAPIVersion(route)
+		if m.apiVersion != nil {
+			version = m.apiVersion(r, pathParams)
+		}
+		if version != "" {
+			kv := APIVersionKey.String(version)
+			opts = append(opts, trace.WithAttributes(kv))
+			metricAttrs = append(metricAttrs, kv)
+		}
+	}
+	if m.combinedProtocol {
+		kv := CombinedProtocolKey.String(combinedProtocol(r))
+		opts = append(opts, trace.WithAttributes(kv))
+		metricAttrs = append(metricAttrs, kv)
+	}
+	if m.conditionalAttr {
+		kv := ConditionalRequestKey.Bool(r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "")
+		opts = append(opts, trace.WithAttributes(kv))
+		metricAttrs = append(metricAttrs, kv)
+	}
+	if m.geoHeader != "" {
+		if country := countryCode(r.Header.Get(m.geoHeader)); country != "" {
+			kv := ClientGeoCountryKey.String(country)
+			opts = append(opts, trace.WithAttributes(kv))
+			metricAttrs = append(metricAttrs, kv)
+		}
+	}
+	if m.authSchemeAttr {
+		if scheme := authScheme(r.Header.Get("Authorization")); scheme != "" {
+			opts = append(opts, trace.WithAttributes(RequestAuthSchemeKey.String(scheme)))
+		}
+	}
+	if m.origins != nil {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			// The configured origin is recorded, clients may vary the case.
+			allowed, ok := m.origins[strings.ToLower(origin)]
+			if !ok {
+				allowed = "other"
+			}
+			kv := RequestOriginKey.String(allowed)
+			opts = append(opts, trace.WithAttributes(kv))
+			metricAttrs = append(metricAttrs, kv)
+		}
+	}
+	if m.operationGroupFn != nil {
+		if group := m.operationGroupFn(r, pathParams); group != "" {
+			kv := OperationGroupKey.String(group)
+			opts = append(opts, trace.WithAttributes(kv))
+			metricAttrs = append(metricAttrs, kv)
+		}
+	}
+	if m.tenantExtractor != nil {
+		if tenant := m.tenantExtractor(r); tenant != "" {
+			opts = append(opts, trace.WithAttributes(TenantIDKey.String(tenant)))
+			metricAttrs = append(metricAttrs, TenantIDKey.String(m.tenants.metricValue(tenant)))
+		}
+	}
+	if m.deadlineAttrs {
+		timeout, ok := propagatedTimeout(ctx, r)
+		opts = append(opts, trace.WithAttributes(DeadlinePropagatedKey.Bool(ok)))
+		if ok {
+			opts = append(opts, trace.WithAttributes(PropagatedTimeoutKey.Int64(timeout.Milliseconds())))
+		}
+	}
+	if m.customVerb != nil {
+		if verb := m.customVerb(r); verb != "" {
+			opts = append(opts, trace.WithAttributes(semconvNew.RPCMethod(verb)))
+		}
+	}
+	if m.redactedParams != nil {
+		opts = append(opts, trace.WithAttributes(semconvNew.URLFull(fullURL(r, scheme, m.redactedParams))))
+	}
+	if m.rangeAttrs {
+		if v := r.Header.Get("Range"); v != "" {
+			opts = append(opts, trace.WithAttributes(RequestRangeKey.String(v)))
+		}
+	}
+	if m.languageAttr {
+		if lang := preferredLanguage(r.Header.Get("Accept-Language")); lang != "" {
+			opts = append(opts, trace.WithAttributes(RequestLanguageKey.String(lang)))
+		}
+	}
+	if m.http2StreamID != nil {
+		if id, ok := m.http2StreamID(r); ok {
+			opts = append(opts, trace.WithAttributes(HTTP2StreamIDKey.Int64(int64(id))))
+		}
+	}
+	if m.headerSizeAttrs {
+		count, size := headerSize(r.Header)
+		opts = append(opts, trace.WithAttributes(RequestHeaderCountKey.Int(count), RequestHeaderSizeKey.Int(size)))
+	}
+	if m.idempotencyHeader != "" {
+		if key := r.Header.Get(m.idempotencyHeader); key != "" {
+			opts = append(opts, trace.WithAttributes(IdempotencyKeyKey.String(key)))
+		}
+	}
+	if m.retryAttemptHeader != "" {
+		if attempt, err := strconv.Atoi(r.Header.Get(m.retryAttemptHeader)); err == nil && attempt >= 0 {
+			opts = append(opts, trace.WithAttributes(RetryAttemptKey.Int(attempt)))
+		}
 	}
 
 	if m.publicEndpoint || (m.publicEndpointFn != nil && m.publicEndpointFn(r.WithContext(ctx))) {
@@ -92,6 +474,43 @@ func (m *handler) serveHTTP(w http.ResponseWriter, r *http.Request, next runtime
 		}
 	}
 
+	if m.clientCertAttrs && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		leaf := r.TLS.PeerCertificates[0]
+		if cn := leaf.Subject.CommonName; cn != "" {
+			opts = append(opts, trace.WithAttributes(ClientCertSubjectCNKey.String(cn)))
+		}
+		if leaf.SerialNumber != nil {
+			opts = append(opts, trace.WithAttributes(ClientCertSerialKey.String(leaf.SerialNumber.Text(16))))
+		}
+	}
+
+	if m.enduserExtractor != nil {
+		if id, role, ok := m.enduserExtractor(ctx); ok {
+			if id != "" {
+				opts = append(opts, trace.WithAttributes(semconvNew.EnduserID(id)))
+			}
+			if role != "" {
+				opts = append(opts, trace.WithAttributes(semconvNew.EnduserRole(role)))
+			}
+		}
+	}
+
+	if m.claimsExtractor != nil {
+		if claims := m.claimsExtractor(ctx); len(claims) > 0 {
+			opts = append(opts, trace.WithAttributes(claimAttributes(claims, m.claimPaths)...))
+		}
+	}
+
+	if m.correlationHeader != "" {
+		if link, ok := parseCorrelationLink(m.correlationHeader, r.Header.Get(m.correlationHeader)); ok {
+			opts = append(opts, trace.WithLinks(link))
+		}
+	}
+
+	if m.spanStartOptionsFn != nil {
+		opts = append(opts, m.spanStartOptionsFn(ctx, r)...)
+	}
+
 	tracer := m.tracer
 	if tracer == nil {
 		if span := trace.SpanFromContext(r.Context()); span.SpanContext().IsValid() {
@@ -101,34 +520,159 @@ func (m *handler) serveHTTP(w http.ResponseWriter, r *http.Request, next runtime
 		}
 	}
 
+	// untraced is tracked explicitly: the noop tracer keeps propagating the
+	// extracted span context, which may be sampled.
+	untraced := m.breaker.isOpen()
+	for _, f := range m.traceFilters {
+		allowed, recovered := m.callFilter(f, r.WithContext(ctx))
+		if recovered != nil {
+			filterPanics = append(filterPanics, recovered)
+		}
+		if !allowed {
+			untraced = true
+			break
+		}
+	}
+	if untraced {
+		tracer = nonRecordingTracer
+	}
+
 	if startTime := StartTimeFromContext(ctx); !startTime.IsZero() {
 		opts = append(opts, trace.WithTimestamp(startTime))
 		reqStartTime = startTime
 	}
 
-	ctx, span := tracer.Start(ctx, m.spanNameFormatter(m.operation, r), opts...)
+	operation := m.operation
+	if m.operationFromRoute && route != "" {
+		operation = route
+	}
+	spanName := m.spanNameFormatter(operation, r)
+	if m.spanNameTemplate != nil {
+		spanName = m.spanNameTemplate.render(operation, route, r, pathParams)
+	}
+
+	ctx, span := tracer.Start(ctx, spanName, opts...)
 	defer span.End()
+	if m.phaseEvents {
+		span.AddEvent(ExtractionDoneEvent, trace.WithTimestamp(extractedAt))
+	}
+	if span.IsRecording() {
+		m.stats.addTraced()
+		m.spanCounters.created.Add(ctx, 1)
+	} else {
+		m.spanCounters.suppressed.Add(ctx, 1)
+	}
+	if len(m.pathParamEvents) > 0 {
+		var params []attribute.KeyValue
+		for _, name := range m.pathParamEvents {
+			if v, ok := pathParams[name]; ok {
+				params = append(params, attribute.String(RouteParamKeyPrefix+name, v))
+			}
+		}
+		if len(params) > 0 {
+			span.AddEvent(RouteParamsEvent, trace.WithAttributes(params...))
+		}
+	}
+	for _, recovered := range filterPanics {
+		span.AddEvent(FilterPanicEvent, trace.WithAttributes(semconvNew.ExceptionMessage(fmt.Sprint(recovered))))
+	}
+	if m.samplingDecision && span.IsRecording() {
+		span.SetAttributes(SampledKey.Bool(span.SpanContext().IsSampled()))
+	}
+
+	readEvent, writeEvent := eventsEnabled(r.Context(), m.readEvent, m.writeEvent)
+
+	var bodyEvents atomic.Int64
+	addBodyEvent := func(name string, kv attribute.KeyValue) {
+		if m.maxBodyEvents > 0 {
+			switch n := bodyEvents.Add(1); {
+			case n == m.maxBodyEvents+1:
+				span.AddEvent(EventsTruncatedEvent)
+				return
+			case n > m.maxBodyEvents:
+				return
+			}
+		}
+		span.AddEvent(name, trace.WithAttributes(kv))
+	}
 
 	readRecordFunc := func(int64) {}
-	if m.readEvent {
+	if readEvent {
 		readRecordFunc = func(n int64) {
-			span.AddEvent("read", trace.WithAttributes(ReadBytesKey.Int64(n)))
+			addBodyEvent("read", ReadBytesKey.Int64(n))
 		}
 	}
 
-	bw := request.NewBodyWrapper(r.Body, readRecordFunc)
-	if r.Body != nil && r.Body != http.NoBody {
+	var decodedSize *request.DecodedSizeCounter
+	hasBody := r.Body != nil && r.Body != http.NoBody
+	// wrapBody is unset for the media types whose bodies must not be
+	// wrapped, their size is then taken from the Content-Length.
+	wrapBody := hasBody && !m.skipBodyWrap(r)
+
+	if m.decodeRequestSize && wrapBody {
+		if c, ok := request.NewDecodedSizeCounter(r.Header.Get("Content-Encoding"), maxDecodedRequestSize); ok {
+			decodedSize = c
+			defer decodedSize.Close()
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, c), r.Body}
+		}
+	}
+
+	// checksum hashes the body as it is read, it is never buffered.
+	var checksum hash.Hash
+	if m.bodyChecksum && wrapBody {
+		checksum = sha256.New()
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, checksum), r.Body}
+	}
+
+	var bw *request.BodyWrapper
+	if m.bodyCloseEvent && wrapBody {
+		closed := &closeNotifyingBody{ReadCloser: r.Body}
+		closed.onClose = func() {
+			span.AddEvent(BodyClosedEvent, trace.WithAttributes(ReadBytesKey.Int64(bw.BytesRead())))
+		}
+		// A body closed once the span has ended, e.g. by net/http after the
+		// handler returned, must not add events to it.
+		defer closed.detach()
+		r.Body = closed
+	}
+
+	bw = request.NewBodyWrapper(r.Body, readRecordFunc)
+	if wrapBody {
 		r.Body = bw
 	}
 
 	writeRecordFunc := func(int64) {}
-	if m.writeEvent {
+	if writeEvent {
 		writeRecordFunc = func(n int64) {
-			span.AddEvent("write", trace.WithAttributes(WroteBytesKey.Int64(n)))
+			addBodyEvent("write", WroteBytesKey.Int64(n))
 		}
 	}
 
-	rww := request.NewRespWriterWrapper(w, writeRecordFunc)
+	// observed is only given to rww, the optional interfaces of w are
+	// still detected by httpsnoop below.
+	var observed http.ResponseWriter = w
+	var observer *responseObserver
+	if m.statusWriteEvent || m.flushCount {
+		observer = &responseObserver{ResponseWriter: w}
+		if m.statusWriteEvent {
+			observer.onWriteHeader = func(statusCode int) {
+				span.AddEvent(StatusWrittenEvent, trace.WithAttributes(semconvNew.HTTPResponseStatusCode(statusCode)))
+			}
+		}
+		observed = observer
+	}
+	rww := request.NewRespWriterWrapper(observed, writeRecordFunc)
+
+	var respCapture *responseBodyCapture
+	if len(m.responseBodyFields) > 0 {
+		respCapture = &responseBodyCapture{limit: m.bodyFieldLimit}
+	}
 
 	// wrap http.ResponseWriter
 	w = httpsnoop.Wrap(w, httpsnoop.Hooks{
@@ -136,7 +680,14 @@ func (m *handler) serveHTTP(w http.ResponseWriter, r *http.Request, next runtime
 			return rww.Header
 		},
 		Write: func(httpsnoop.WriteFunc) httpsnoop.WriteFunc {
-			return rww.Write
+			if respCapture == nil {
+				return rww.Write
+			}
+			return func(b []byte) (int, error) {
+				n, err := rww.Write(b)
+				respCapture.capture(b[:n])
+				return n, err
+			}
 		},
 		WriteHeader: func(httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
 			return rww.WriteHeader
@@ -150,53 +701,386 @@ func (m *handler) serveHTTP(w http.ResponseWriter, r *http.Request, next runtime
 	if !found {
 		ctx = ContextWithLabeler(ctx, labeler)
 	}
+	ctx, handlerErr := handlerErrorFromContext(ctx)
 
-	next(w, r.WithContext(ctx), pathParams)
+	if m.responsePropagator != nil {
+		m.responsePropagator.Inject(ctx, propagation.HeaderCarrier(w.Header()))
+	}
+
+	if m.phaseEvents {
+		span.AddEvent(HandlerStartEvent)
+	}
+	next(w, r.WithContext(ContextWithInstrumented(ctx)), pathParams)
+	if m.phaseEvents {
+		span.AddEvent(HandlerDoneEvent)
+	}
+
+	if m.drainRequestBody > 0 && wrapBody {
+		// Whatever the handler left unread is counted as read, so that
+		// the recorded size is complete and the connection can be reused.
+		_, _ = io.CopyN(io.Discard, bw, m.drainRequestBody)
+		_ = bw.Close()
+	}
+
+	requestSize := bw.BytesRead()
+	if hasBody && !wrapBody {
+		requestSize = max(r.ContentLength, 0)
+	}
 
 	// collect metrics
 	statusCode := rww.StatusCode()
+	if m.dropUnmatched && statusCode == http.StatusNotFound && route == "" && len(pathParams) == 0 {
+		// The status is only known now: the span is marked for the pipeline
+		// to drop rather than left unended.
+		span.SetAttributes(UnmatchedRouteKey.Bool(true))
+	}
 	bytesWritten := rww.BytesWritten()
-	span.SetStatus(m.semconv.Status(statusCode))
+	if err := handlerErr.get(); err != nil {
+		span.RecordError(err)
+		// Errors that do not carry a gRPC status have the Unknown code.
+		kv := semconvNew.RPCGRPCStatusCodeKey.Int(int(status.Code(err)))
+		span.SetAttributes(kv)
+		metricAttrs = append(metricAttrs, kv)
+	}
+	spanStatus, spanStatusDesc := m.semconv.Status(statusCode)
+	span.SetStatus(spanStatus, spanStatusDesc)
+	if spanStatus == codes.Error {
+		m.stats.addError()
+	}
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if timedOut {
+		span.SetAttributes(ServerTimeoutKey.Bool(true))
+	}
+	if kind := errorKind(bw.Error(), timedOut, spanStatus); kind != "" {
+		kv := ErrorKindKey.String(kind)
+		span.SetAttributes(kv)
+		metricAttrs = append(metricAttrs, kv)
+	}
+	if m.errorOnlyAttrsFn != nil && spanStatus == codes.Error {
+		span.SetAttributes(m.errorOnlyAttrsFn(r, statusCode)...)
+	}
 	span.SetAttributes(m.semconv.ResponseTraceAttrs(semconv.ResponseTelemetry{
 		StatusCode: statusCode,
-		ReadBytes:  bw.BytesRead(),
+		ReadBytes:  requestSize,
 		ReadError:  bw.Error(),
 		WriteBytes: bytesWritten,
 		WriteError: rww.Error(),
 	})...)
+	if readErr := bw.Error(); wrapBody && r.ContentLength >= 0 && requestSize != r.ContentLength &&
+		(errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF)) {
+		// The body was read to its end but its length differs from the announced one.
+		span.SetAttributes(
+			RequestBodyLengthMismatchKey.Bool(true),
+			RequestBodyDeclaredSizeKey.Int64(r.ContentLength),
+			RequestBodyReadSizeKey.Int64(requestSize),
+		)
+	}
+	if m.recordEOFErrors {
+		if err := bw.Error(); err != nil {
+			span.SetAttributes(ReadErrorKey.String(err.Error()))
+		}
+		if err := rww.Error(); err != nil {
+			span.SetAttributes(WriteErrorKey.String(err.Error()))
+		}
+	}
+	if respCapture != nil {
+		span.SetAttributes(respCapture.attributes(m.responseBodyFields)...)
+	}
+	if checksum != nil && bw.BytesRead() > 0 {
+		span.SetAttributes(RequestBodyChecksumKey.String(hex.EncodeToString(checksum.Sum(nil))))
+	}
+	if decodedSize != nil {
+		if n, err := decodedSize.Close(); err == nil {
+			span.SetAttributes(RequestBodyUncompressedSizeKey.Int64(n))
+		}
+	}
+	if m.cacheStatusHeader != "" {
+		if v := cacheStatus(rww.Header().Get(m.cacheStatusHeader)); v != "" {
+			kv := CacheStatusKey.String(v)
+			span.SetAttributes(kv)
+			metricAttrs = append(metricAttrs, kv)
+		}
+	}
+	if m.flushCount {
+		span.SetAttributes(ResponseFlushCountKey.Int64(observer.flushes.Load()))
+	}
+	if m.cacheValidators {
+		if v := rww.Header().Get("ETag"); v != "" {
+			span.SetAttributes(ResponseETagKey.String(v))
+		}
+		if v := rww.Header().Get("Last-Modified"); v != "" {
+			span.SetAttributes(ResponseLastModifiedKey.String(v))
+		}
+	}
+	if m.rangeAttrs {
+		if v := rww.Header().Get("Content-Range"); v != "" {
+			span.SetAttributes(ResponseContentRangeKey.String(v))
+		}
+	}
+	if m.transactionID != nil {
+		if id, ok := m.transactionID(r, rww.Header()); ok {
+			span.SetAttributes(TransactionIDKey.String(id))
+		}
+	}
+	if m.responseCompressed {
+		encoding := strings.TrimSpace(rww.Header().Get("Content-Encoding"))
+		kv := ResponseCompressedKey.Bool(encoding != "" && !strings.EqualFold(encoding, "identity"))
+		span.SetAttributes(kv)
+		metricAttrs = append(metricAttrs, kv)
+	}
+	if m.varyAttr {
+		if v := rww.Header().Values("Vary"); len(v) > 0 {
+			span.SetAttributes(ResponseVaryKey.String(strings.Join(v, ", ")))
+		}
+	}
+	if m.outboundType {
+		if v := rww.Header().Get("Content-Type"); v != "" {
+			span.SetAttributes(OutboundContentTypeKey.String(v))
+		}
+	}
+	if m.sizeBuckets != nil {
+		kv := ResponseSizeBucketKey.String(m.sizeBucket(bytesWritten))
+		span.SetAttributes(kv)
+		metricAttrs = append(metricAttrs, kv)
+	}
+	for i, key := range []attribute.Key{RateLimitLimitKey, RateLimitRemainingKey, RateLimitResetKey} {
+		if name := m.rateLimitHeaders[i]; name != "" {
+			if v, err := strconv.ParseInt(strings.TrimSpace(rww.Header().Get(name)), 10, 64); err == nil {
+				span.SetAttributes(key.Int64(v))
+			}
+		}
+	}
+	if m.timestampAttrs {
+		span.SetAttributes(
+			RequestStartUnixNanoKey.Int64(reqStartTime.UnixNano()),
+			ResponseEndUnixNanoKey.Int64(time.Now().UnixNano()),
+		)
+	}
+
+	elapsed := time.Since(reqStartTime)
+	if m.nanosDuration {
+		span.SetAttributes(RequestDurationNanosKey.Int64(elapsed.Nanoseconds()))
+	}
+	if m.latencyBuckets {
+		span.SetAttributes(LatencyBucketKey.String(m.latencyBucket(elapsed)))
+	}
+	if m.samplingPriority != nil {
+		span.SetAttributes(SamplingPriorityKey.Int(m.samplingPriority(r, statusCode, elapsed)))
+	}
+	if m.concurrencySlow > 0 && elapsed > m.concurrencySlow {
+		span.SetAttributes(
+			InFlightRequestsKey.Int64(m.inFlight.Load()),
+			GoroutinesKey.Int(goruntime.NumGoroutine()),
+		)
+	}
+
+	if m.sampledMetrics && (untraced || !span.SpanContext().IsSampled()) {
+		return
+	}
 
-	elapsedTime := float64(time.Since(reqStartTime)) / float64(time.Millisecond)
+	elapsedTime := float64(elapsed) / float64(time.Millisecond)
+	var additionalAttributes []attribute.KeyValue
+	if m.highLoadThreshold == 0 || m.inFlight.Load() <= m.highLoadThreshold {
+		additionalAttributes = m.allowedMetricAttributes(append(labeler.Get(), m.metricAttributesFromRequest(r)...))
+		additionalAttributes = append(additionalAttributes, m.resourceAttributes...)
+		additionalAttributes = append(additionalAttributes, metricAttrs...)
+	}
 	metricAttributes := semconv.MetricAttributes{
-		Req:                  r,
+		Req:                  semconvReq,
 		StatusCode:           statusCode,
-		AdditionalAttributes: append(labeler.Get(), m.metricAttributesFromRequest(r)...),
+		AdditionalAttributes: additionalAttributes,
 	}
 
-	m.semconv.RecordMetrics(ctx, semconv.ServerMetricData{
-		ServerName:       m.server,
+	metricData := semconv.ServerMetricData{
+		ServerName:       server,
 		ResponseSize:     bytesWritten,
 		MetricAttributes: metricAttributes,
 		MetricData: semconv.MetricData{
-			RequestSize: bw.BytesRead(),
+			RequestSize: requestSize,
 			ElapsedTime: elapsedTime,
 		},
-	})
+	}
+	if m.asyncMetrics != nil {
+		// The metrics may still be dropped, metrics_recorded would not hold.
+		m.asyncMetrics.record(ctx, metricData)
+		return
+	}
+	m.semconv.RecordMetrics(ctx, metricData)
+	if m.phaseEvents {
+		span.AddEvent(MetricsRecordedEvent)
+	}
 }
 
 // configure executes the configuration from config into the handler.
 func (m *handler) configure(c *config) {
 	m.tracer = c.Tracer
 	m.propagators = c.Propagators
+	m.carrierFn = c.CarrierFn
 	m.spanStartOptions = c.SpanStartOptions
+	m.spanStartOptionsFn = c.SpanStartOptionsFn
 	m.readEvent = c.ReadEvent
 	m.writeEvent = c.WriteEvent
 	m.filters = c.Filters
 	m.spanNameFormatter = c.SpanNameFormatter
 	m.publicEndpoint = c.PublicEndpoint
 	m.publicEndpointFn = c.PublicEndpointFn
+	if c.FixedServerPort > 0 {
+		m.fixedServerPort = strconv.Itoa(c.FixedServerPort)
+	}
 	m.server = c.ServerName
+	if m.server != "" {
+		m.server = m.withFixedPort(m.server)
+	}
 	m.semconv = semconv.NewHTTPServer(c.Meter)
+	m.routeCardinality = semconv.NewRouteCardinality(c.Meter, routeCardinalityLimit)
+	m.spanCounters = newSpanCounters(c.Meter)
 	m.metricAttributesFn = c.MetricAttributesFn
+	m.diagnosticAttrs = c.DiagnosticAttrs
+	m.bodyChecksum = c.BodyChecksum
+	m.resourceAttributes = c.ResourceAttributes
+	m.retryAttemptHeader = c.RetryAttemptHeader
+	m.decodeRequestSize = c.DecodeRequestSize
+	m.bodyFields = c.BodyFields
+	m.bodyFieldLimit = c.BodyFieldLimit
+	m.statusWriteEvent = c.StatusWriteEvent
+	m.requestContentType = c.RequestContentType
+	if len(c.ContentTypeMetricTypes) > 0 {
+		m.contentTypeMetrics = make(map[string]struct{}, len(c.ContentTypeMetricTypes))
+		for _, mt := range c.ContentTypeMetricTypes {
+			m.contentTypeMetrics[mediaType(mt)] = struct{}{}
+		}
+	}
+	m.methodOverride = c.MethodOverrideHeader
+	m.drainRequestBody = int64(c.DrainRequestBody)
+	m.correlationHeader = c.CorrelationLinkHeader
+	m.cacheStatusHeader = c.CacheStatusHeader
+	m.patternObserver = c.PatternObserver
+	m.errorOnlyAttrsFn = c.ErrorOnlyAttributesFn
+	m.enduserExtractor = c.EnduserExtractor
+	m.timestampAttrs = c.TimestampAttrs
+	m.traceFilters = c.TraceFilters
+	m.backendResolver = c.BackendResolver
+	m.latencyBuckets = c.LatencyBuckets
+	m.latencyFast = c.LatencyFast
+	m.latencySlow = c.LatencySlow
+	m.maxBodyEvents = int64(c.MaxBodyEvents)
+	m.samplingDecision = c.SamplingDecisionAttr
+	m.schemeResolver = c.SchemeResolver
+	m.responseBodyFields = c.ResponseBodyFields
+	m.pathParamCount = c.PathParamCount
+	m.trustedProxyCount = c.TrustedProxyCount
+	m.sniServerAddress = c.SNIServerAddress
+	m.dropUnmatched = c.DropUnmatchedRoutes
+	m.rateLimitHeaders = c.RateLimitHeaders
+	m.clientCertAttrs = c.ClientCertAttrs
+	m.filterPanicPolicy = c.FilterPanicPolicy
+	m.operationGroupFn = c.OperationGroupFn
+	m.concurrencySlow = c.ConcurrencySnapshot
+	m.pathParamEvents = c.PathParamEvents
+	m.recordEOFErrors = c.RecordEOFErrors
+	m.routeResolver = c.RouteResolver
+	if m.routeResolver == nil {
+		m.routeResolver = routeFromRequest
+	}
+	m.operationFromRoute = c.OperationFromRoute
+	m.responsePropagator = c.ResponsePropagator
+	m.tenantExtractor = c.TenantExtractor
+	m.nanosDuration = c.NanosecondDurationAttr
+	m.sampledMetrics = c.MetricsFollowSampling
+	m.languageAttr = c.LanguageAttr
+	m.http2StreamID = c.HTTP2StreamID
+	m.traceStateFn = c.TraceStateFn
+	m.responseCompressed = c.ResponseCompressedAttr
+	m.transactionID = c.TransactionIDExtractor
+	m.rangeAttrs = c.RangeAttrs
+	m.customVerb = c.CustomVerbResolver
+	m.highLoadThreshold = int64(c.HighLoadThreshold)
+	m.bodyCloseEvent = c.BodyCloseEvent
+	m.deadlineAttrs = c.DeadlinePropagationAttrs
+	m.combinedProtocol = c.CombinedProtocolAttr
+	m.idempotencyHeader = c.IdempotencyKeyHeader
+	m.skipInstrumented = c.SkipIfInstrumented
+	m.cacheValidators = c.CacheValidatorAttrs
+	m.conditionalAttr = c.ConditionalRequestAttr
+	m.flushCount = c.FlushCountAttr
+	m.headerSizeAttrs = c.HeaderSizeAttrs
+	m.geoHeader = c.GeoHeader
+	m.authSchemeAttr = c.AuthSchemeAttr
+	m.outboundType = c.OutboundContentTypeAttr
+	m.phaseEvents = c.PhaseEvents
+	m.samplingPriority = c.SamplingPriorityFn
+	m.varyAttr = c.VaryAttr
+	if len(c.JWTClaimPaths) > 0 {
+		m.claimPaths = c.JWTClaimPaths
+		m.claimsExtractor = c.ClaimsExtractor
+	}
+	if len(c.ResponseSizeBuckets) > 0 {
+		m.sizeBuckets = slices.Sorted(slices.Values(c.ResponseSizeBuckets))
+		if limit := len(responseSizeBuckets) - 1; len(m.sizeBuckets) > limit {
+			otel.Handle(fmt.Errorf("otelgrpcgw: %d response size thresholds given, only the %d smallest are used", len(m.sizeBuckets), limit))
+			m.sizeBuckets = m.sizeBuckets[:limit]
+		}
+	}
+	if c.InstanceAttrs {
+		if hostname, err := os.Hostname(); err == nil {
+			m.instanceAttrs = append(m.instanceAttrs, semconvNew.HostName(hostname))
+		} else {
+			otel.Handle(err)
+		}
+		m.instanceAttrs = append(m.instanceAttrs, semconvNew.ProcessPID(os.Getpid()))
+	}
+	if c.FullURLAttr {
+		m.redactedParams = make(map[string]struct{}, len(defaultRedactedQueryParams)+len(c.RedactedQueryParams))
+		for _, p := range append(defaultRedactedQueryParams, c.RedactedQueryParams...) {
+			m.redactedParams[strings.ToLower(p)] = struct{}{}
+		}
+	}
+	if c.BreakerThreshold > 0 {
+		m.breaker = &circuitBreaker{threshold: int64(c.BreakerThreshold), cooldown: c.BreakerCooldown}
+	}
+	if c.OriginAllowlist != nil {
+		m.origins = make(map[string]string, len(c.OriginAllowlist))
+		for _, origin := range c.OriginAllowlist {
+			m.origins[strings.ToLower(origin)] = origin
+		}
+	}
+	if m.tenantExtractor != nil {
+		m.tenants = newTenantSet(tenantCardinalityLimit)
+	}
+	if len(c.NoBodyWrapContentTypes) > 0 {
+		m.noBodyWrapTypes = make(map[string]struct{}, len(c.NoBodyWrapContentTypes))
+		for _, t := range c.NoBodyWrapContentTypes {
+			m.noBodyWrapTypes[mediaType(t)] = struct{}{}
+		}
+	}
+	m.apiVersionAttr = c.APIVersionAttr
+	m.apiVersion = c.APIVersionExtractor
+	if c.SelfStats {
+		m.stats = &selfStats{}
+	}
+	if m.schemeResolver == nil {
+		m.schemeResolver = defaultSchemeResolver
+	}
+	if c.SpanNameTemplate != "" {
+		m.spanNameTemplate = parseSpanNameTemplate(c.SpanNameTemplate)
+	}
+	if len(c.MetricAttributeAllowlist) > 0 {
+		m.metricAllowlist = make(map[attribute.Key]struct{}, len(c.MetricAttributeAllowlist))
+		for _, k := range c.MetricAttributeAllowlist {
+			m.metricAllowlist[attribute.Key(k)] = struct{}{}
+		}
+	}
+	m.fastPath = isNoopTracerProvider(c.TracerProvider) && isNoopMeterProvider(c.MeterProvider) && c.onlyFastPathOptions()
+	if c.AsyncMetricsBuffer > 0 && !m.fastPath {
+		m.asyncMetrics = newAsyncMetrics(m.semconv, c.Meter, c.AsyncMetricsBuffer)
+	}
+}
+
+func (m *handler) carrier(r *http.Request) propagation.TextMapCarrier {
+	if m.carrierFn != nil {
+		return m.carrierFn(r)
+	}
+	return propagation.HeaderCarrier(r.Header)
 }
 
 func (m *handler) metricAttributesFromRequest(r *http.Request) []attribute.KeyValue {
@@ -206,3 +1090,148 @@ func (m *handler) metricAttributesFromRequest(r *http.Request) []attribute.KeyVa
 	}
 	return attributeForRequest
 }
+
+// skipBodyWrap reports whether the body of r must be left unwrapped because
+// of its media type.
+func (m *handler) skipBodyWrap(r *http.Request) bool {
+	if m.noBodyWrapTypes == nil {
+		return false
+	}
+	_, ok := m.noBodyWrapTypes[mediaType(r.Header.Get("Content-Type"))]
+	return ok
+}
+
+// withFixedPort returns server with its port replaced by the fixed server
+// port, if any.
+func (m *handler) withFixedPort(server string) string {
+	if m.fixedServerPort == "" {
+		return server
+	}
+	host, _ := semconv.SplitHostPort(server)
+	return net.JoinHostPort(host, m.fixedServerPort)
+}
+
+// fixedServer is a Host header and the server it is recorded as, see
+// hostWithFixedPort.
+type fixedServer struct {
+	host   string
+	server string
+}
+
+// hostWithFixedPort returns host with its port replaced by the fixed server
+// port. The requests of a server usually share their Host header, so the last
+// one is kept to not split and join it again on every request.
+func (m *handler) hostWithFixedPort(host string) string {
+	if last := m.lastFixedServer.Load(); last != nil && last.host == host {
+		return last.server
+	}
+	server := m.withFixedPort(host)
+	m.lastFixedServer.Store(&fixedServer{host: host, server: server})
+	return server
+}
+
+// latencyBucket returns the latency bucket a request taking elapsed falls in.
+func (m *handler) latencyBucket(elapsed time.Duration) string {
+	switch {
+	case elapsed < m.latencyFast:
+		return "fast"
+	case elapsed >= m.latencySlow:
+		return "slow"
+	default:
+		return "normal"
+	}
+}
+
+// responseSizeBuckets are the names of the response size buckets, in
+// ascending order of size.
+var responseSizeBuckets = [...]string{"small", "medium", "large", "xlarge"}
+
+// sizeBucket returns the response size bucket a response of size bytes falls in.
+func (m *handler) sizeBucket(size int64) string {
+	i := 0
+	for _, threshold := range m.sizeBuckets {
+		if size < int64(threshold) {
+			break
+		}
+		i++
+	}
+	return responseSizeBuckets[i]
+}
+
+// routeAPIVersion returns the first segment of the route template made of a
+// "v" followed by digits, e.g. "v2".
+func routeAPIVersion(route string) string {
+	for _, segment := range strings.Split(strings.Trim(route, "/"), "/") {
+		if isVersionSegment(segment) {
+			return segment
+		}
+	}
+	return ""
+}
+
+// defaultSchemeResolver returns the scheme of the X-Forwarded-Proto header,
+// or whether r was received over TLS when it is absent.
+func defaultSchemeResolver(r *http.Request) string {
+	if proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ","); proto != "" {
+		return strings.ToLower(strings.TrimSpace(proto))
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// tlsPlaceholder marks requests resolved to the https scheme that were not
+// received over TLS.
+var tlsPlaceholder = &tls.ConnectionState{}
+
+// withScheme returns r, or a shallow copy of it whose TLS field agrees with
+// scheme, since semconv derives url.scheme and the default server.port from it.
+func withScheme(r *http.Request, scheme string) *http.Request {
+	switch {
+	case scheme == "https" && r.TLS == nil:
+		r2 := *r
+		r2.TLS = tlsPlaceholder
+		return &r2
+	case scheme == "http" && r.TLS != nil:
+		r2 := *r
+		r2.TLS = nil
+		return &r2
+	}
+	return r
+}
+
+// unnamedUnixAddr is the RemoteAddr net/http sets for the unnamed peer of a
+// unix socket connection.
+const unnamedUnixAddr = "@"
+
+// isUnixSocket reports whether r was received on a unix socket.
+func isUnixSocket(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// routeFromRequest returns the path template of the grpc-gateway pattern that
+// matched r, or an empty string when r was not dispatched by a runtime.ServeMux.
+func routeFromRequest(r *http.Request) string {
+	if p, ok := runtime.HTTPPattern(r.Context()); ok {
+		return p.String()
+	}
+	return ""
+}
+
+// allowedMetricAttributes drops the attributes whose key is not allowlisted,
+// reusing the backing array of attrs. All attributes are kept when no
+// allowlist is configured.
+func (m *handler) allowedMetricAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if m.metricAllowlist == nil {
+		return attrs
+	}
+	allowed := attrs[:0]
+	for _, kv := range attrs {
+		if _, ok := m.metricAllowlist[kv.Key]; ok {
+			allowed = append(allowed, kv)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,51 @@
+package otelgrpcgw
+
+import (
+	"context"
+	"sync"
+)
+
+// handlerError holds the error a grpc-gateway handler failed with. The
+// middleware installs one in the request context, so that the error stored by
+// an ErrorHandler further down the context chain is visible to it.
+type handlerError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (h *handlerError) set(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.err = err
+}
+
+func (h *handlerError) get() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+type handlerErrorKey struct{}
+
+// ContextWithHandlerError stores err as the error the request of ctx failed
+// with, meant to be called by a grpc-gateway ErrorHandler before writing the
+// error response. The middleware records the last stored error on the span of
+// the request, since only the status code remains visible in the response,
+// and its gRPC status code as rpc.grpc.status_code on the span and metrics.
+func ContextWithHandlerError(ctx context.Context, err error) context.Context {
+	if h, ok := ctx.Value(handlerErrorKey{}).(*handlerError); ok {
+		h.set(err)
+		return ctx
+	}
+	return context.WithValue(ctx, handlerErrorKey{}, &handlerError{err: err})
+}
+
+// handlerErrorFromContext returns the handlerError installed in ctx, or a new
+// one along with a context carrying it.
+func handlerErrorFromContext(ctx context.Context) (context.Context, *handlerError) {
+	if h, ok := ctx.Value(handlerErrorKey{}).(*handlerError); ok {
+		return ctx, h
+	}
+	h := &handlerError{}
+	return context.WithValue(ctx, handlerErrorKey{}, h), h
+}
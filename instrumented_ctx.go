@@ -0,0 +1,19 @@
+package otelgrpcgw
+
+import "context"
+
+type instrumentedKey struct{}
+
+// ContextWithInstrumented returns a copy of parent marked as instrumented by a
+// middleware. The middleware marks the context of the requests it instruments,
+// so that nested instances configured WithSkipIfAlreadyInstrumented leave them
+// alone. It can also be called by other instrumentation creating server spans.
+func ContextWithInstrumented(parent context.Context) context.Context {
+	return context.WithValue(parent, instrumentedKey{}, true)
+}
+
+// IsInstrumented reports whether ctx was marked with ContextWithInstrumented.
+func IsInstrumented(ctx context.Context) bool {
+	instrumented, _ := ctx.Value(instrumentedKey{}).(bool)
+	return instrumented
+}
@@ -0,0 +1,88 @@
+package request
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strings"
+)
+
+var _ io.Writer = &DecodedSizeCounter{}
+
+// ErrDecodedSizeLimit is returned by DecodedSizeCounter.Close when the stream
+// decompresses to more than the limit of the counter.
+var ErrDecodedSizeLimit = errors.New("decoded size limit exceeded")
+
+// DecodedSizeCounter computes the decompressed size of a compressed stream
+// written to it. The stream is decompressed on the fly and discarded, so
+// nothing is buffered. Decoding stops at a limit, so that a small stream
+// inflating to a huge one does not use unbounded CPU. Write never fails, a
+// corrupt or too large stream only makes Close report an error.
+type DecodedSizeCounter struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+
+	// written only by the decoding goroutine, read after done is closed.
+	decoded int64
+	err     error
+}
+
+// NewDecodedSizeCounter returns a DecodedSizeCounter for the given
+// Content-Encoding, decoding at most limit bytes. It returns false if the
+// encoding is not supported.
+func NewDecodedSizeCounter(encoding string, limit int64) (*DecodedSizeCounter, bool) {
+	var newReader func(io.Reader) (io.Reader, error)
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		newReader = func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }
+	case "deflate":
+		newReader = func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }
+	default:
+		return nil, false
+	}
+
+	pr, pw := io.Pipe()
+	c := &DecodedSizeCounter{
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+
+		zr, err := newReader(pr)
+		if err == nil {
+			c.decoded, err = io.Copy(io.Discard, io.LimitReader(zr, limit+1))
+			if err == nil && c.decoded > limit {
+				c.decoded, err = limit, ErrDecodedSizeLimit
+			}
+		}
+		c.err = err
+		// Unblock any pending or future Write, the rest of the stream is
+		// not decoded once the limit is reached.
+		_ = pr.CloseWithError(err)
+	}()
+	return c, true
+}
+
+// Write feeds compressed bytes to the decoder.
+func (c *DecodedSizeCounter) Write(p []byte) (int, error) {
+	// Errors mean the decoder gave up, which is reported by Close.
+	_, _ = c.pw.Write(p)
+	return len(p), nil
+}
+
+// Close signals the end of the compressed stream and returns the number of
+// decompressed bytes. A stream that ends early, e.g. because the body was not
+// fully read, yields the size decoded so far. An error is returned if the
+// stream could not be decoded, or ErrDecodedSizeLimit with the limit if it
+// decodes to more than the limit. Close may be called multiple times.
+func (c *DecodedSizeCounter) Close() (int64, error) {
+	_ = c.pw.Close()
+	<-c.done
+
+	if c.err != nil && !errors.Is(c.err, io.ErrUnexpectedEOF) {
+		return c.decoded, c.err
+	}
+	return c.decoded, nil
+}
@@ -0,0 +1,74 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodedSizeCounter(t *testing.T) {
+	payload := strings.Repeat("hello world ", 100)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte(payload))
+	require.NoError(t, zw.Close())
+
+	var zl bytes.Buffer
+	zlw := zlib.NewWriter(&zl)
+	_, _ = zlw.Write([]byte(payload))
+	require.NoError(t, zlw.Close())
+
+	for encoding, body := range map[string][]byte{"gzip": gz.Bytes(), "deflate": zl.Bytes()} {
+		t.Run(encoding, func(t *testing.T) {
+			c, ok := NewDecodedSizeCounter(encoding, 1<<20)
+			require.True(t, ok)
+
+			_, err := io.Copy(c, bytes.NewReader(body))
+			require.NoError(t, err)
+
+			n, err := c.Close()
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(payload)), n)
+		})
+	}
+}
+
+func TestDecodedSizeCounterInvalid(t *testing.T) {
+	_, ok := NewDecodedSizeCounter("br", 1<<20)
+	assert.False(t, ok)
+
+	c, ok := NewDecodedSizeCounter("gzip", 1<<20)
+	require.True(t, ok)
+
+	n, err := c.Write([]byte("not gzip at all"))
+	assert.NoError(t, err)
+	assert.Equal(t, 15, n)
+
+	_, err = c.Close()
+	assert.Error(t, err)
+}
+
+func TestDecodedSizeCounterLimit(t *testing.T) {
+	// A few KiB of zeros decompressing to far more than the limit.
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(make([]byte, 8<<20))
+	require.NoError(t, zw.Close())
+
+	c, ok := NewDecodedSizeCounter("gzip", 1<<10)
+	require.True(t, ok)
+
+	_, err := io.Copy(c, bytes.NewReader(gz.Bytes()))
+	require.NoError(t, err)
+
+	n, err := c.Close()
+	assert.ErrorIs(t, err, ErrDecodedSizeLimit)
+	assert.Equal(t, int64(1<<10), n)
+}
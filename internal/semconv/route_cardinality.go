@@ -0,0 +1,144 @@
+package semconv
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RouteCardinalityName is the name of the gauge reporting the number of
+// distinct http.route values seen by a server.
+const RouteCardinalityName = "http.server.route.cardinality"
+
+// RouteCardinality tracks the distinct routes seen by a server, up to a limit,
+// and reports their number as the http.server.route.cardinality gauge. A value
+// growing towards the limit usually means unsanitized paths are used as routes.
+//
+// The RouteCardinality values created with the same meter share their routes
+// and a single gauge callback, so that the gauge counts the routes of every
+// handler of the server rather than those of an arbitrary one.
+type RouteCardinality struct {
+	meter      metric.Meter
+	set        *routeSet
+	unregister sync.Once
+}
+
+// routeSet is the set of routes shared by the RouteCardinality values of a
+// meter.
+type routeSet struct {
+	limit int
+
+	mu     sync.Mutex
+	routes map[string]struct{}
+
+	// refs and registration are guarded by routeSetsMu.
+	refs         int
+	registration metric.Registration
+}
+
+var (
+	routeSetsMu sync.Mutex
+	routeSets   = make(map[metric.Meter]*routeSet)
+)
+
+// NewRouteCardinality returns a RouteCardinality remembering at most limit
+// routes, the limit of the first RouteCardinality of meter is kept. The gauge
+// is not registered if meter is nil.
+func NewRouteCardinality(meter metric.Meter, limit int) *RouteCardinality {
+	if meter == nil || !reflect.TypeOf(meter).Comparable() {
+		// A meter that cannot be a map key gets its own set and callback.
+		c := &RouteCardinality{set: newRouteSet(limit)}
+		if meter != nil {
+			c.set.register(meter)
+		}
+		return c
+	}
+
+	routeSetsMu.Lock()
+	defer routeSetsMu.Unlock()
+
+	set, ok := routeSets[meter]
+	if !ok {
+		set = newRouteSet(limit)
+		set.register(meter)
+		routeSets[meter] = set
+	}
+	set.refs++
+	return &RouteCardinality{meter: meter, set: set}
+}
+
+func newRouteSet(limit int) *routeSet {
+	return &routeSet{
+		limit:  limit,
+		routes: make(map[string]struct{}),
+	}
+}
+
+// register registers the gauge reporting s with meter.
+func (s *routeSet) register(meter metric.Meter) {
+	gauge, err := meter.Int64ObservableGauge(
+		RouteCardinalityName,
+		metric.WithUnit("{route}"),
+		metric.WithDescription("Number of distinct routes served, capped at the tracking limit."),
+	)
+	handleErr(err)
+	if err != nil {
+		return
+	}
+
+	s.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(gauge, int64(s.count()))
+		return nil
+	}, gauge)
+	handleErr(err)
+}
+
+func (s *routeSet) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.routes)
+}
+
+// Observe records that route was served. Empty routes are ignored.
+func (c *RouteCardinality) Observe(route string) {
+	if route == "" {
+		return
+	}
+
+	c.set.mu.Lock()
+	defer c.set.mu.Unlock()
+
+	if len(c.set.routes) >= c.set.limit {
+		return
+	}
+	c.set.routes[route] = struct{}{}
+}
+
+// Count returns the number of distinct routes seen, at most the limit.
+func (c *RouteCardinality) Count() int {
+	return c.set.count()
+}
+
+// Unregister stops reporting the gauge once every RouteCardinality sharing
+// it is unregistered. Calls after the first one do nothing.
+func (c *RouteCardinality) Unregister() error {
+	var err error
+	c.unregister.Do(func() {
+		routeSetsMu.Lock()
+		defer routeSetsMu.Unlock()
+
+		if c.meter != nil {
+			if c.set.refs--; c.set.refs > 0 {
+				return
+			}
+			delete(routeSets, c.meter)
+		}
+		if c.set.registration != nil {
+			err = c.set.registration.Unregister()
+		}
+	})
+	return err
+}
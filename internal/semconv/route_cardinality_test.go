@@ -0,0 +1,91 @@
+package semconv
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func collectRouteCardinality(t *testing.T, reader sdkmetric.Reader) (int64, bool) {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == RouteCardinalityName {
+				gauge := m.Data.(metricdata.Gauge[int64])
+				require.Len(t, gauge.DataPoints, 1)
+				return gauge.DataPoints[0].Value, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestRouteCardinality(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	c := NewRouteCardinality(meter, 10)
+
+	c.Observe("")
+	for i := 0; i < 3; i++ {
+		c.Observe("/v1/users/{id}")
+	}
+	v, ok := collectRouteCardinality(t, reader)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), v)
+
+	for i := 0; i < 100; i++ {
+		c.Observe("/v1/users/" + strconv.Itoa(i))
+	}
+	v, _ = collectRouteCardinality(t, reader)
+	assert.Equal(t, int64(10), v)
+
+	require.NoError(t, c.Unregister())
+	_, ok = collectRouteCardinality(t, reader)
+	assert.False(t, ok)
+}
+
+func TestRouteCardinalityShared(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	a := NewRouteCardinality(meter, 10)
+	b := NewRouteCardinality(meter, 10)
+
+	a.Observe("/v1/users/{id}")
+	b.Observe("/v1/orders/{id}")
+	b.Observe("/v1/users/{id}")
+	v, ok := collectRouteCardinality(t, reader)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), v)
+
+	// The gauge is reported until both are unregistered.
+	require.NoError(t, a.Unregister())
+	require.NoError(t, a.Unregister())
+	v, ok = collectRouteCardinality(t, reader)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), v)
+
+	require.NoError(t, b.Unregister())
+	_, ok = collectRouteCardinality(t, reader)
+	assert.False(t, ok)
+
+	// A new RouteCardinality starts over.
+	c := NewRouteCardinality(meter, 10)
+	assert.Equal(t, 0, c.Count())
+	require.NoError(t, c.Unregister())
+}
+
+func TestRouteCardinalityNilMeter(t *testing.T) {
+	c := NewRouteCardinality(nil, 1)
+	c.Observe("/a")
+	c.Observe("/b")
+	assert.Equal(t, 1, c.Count())
+	assert.NoError(t, c.Unregister())
+}
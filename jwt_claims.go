@@ -0,0 +1,93 @@
+package otelgrpcgw
+
+import (
+	"encoding/json"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// claimAttributes returns an attribute named JWTClaimKeyPrefix+path for each
+// of the paths found in claims. Nested claims are selected with dot-separated
+// paths, e.g. "realm_access.roles"; a key containing dots itself, such as a
+// namespaced claim URL, is matched before the path is split. Objects are not
+// recorded, only the claims they contain.
+func claimAttributes(claims map[string]any, paths []string) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, path := range paths {
+		v, ok := lookupClaim(claims, path)
+		if !ok {
+			continue
+		}
+		if kv, ok := claimAttribute(attribute.Key(JWTClaimKeyPrefix+path), v); ok {
+			attrs = append(attrs, kv)
+		}
+	}
+	return attrs
+}
+
+// lookupClaim returns the claim at the dot-separated path in claims.
+func lookupClaim(claims map[string]any, path string) (any, bool) {
+	for {
+		if v, ok := claims[path]; ok {
+			return v, true
+		}
+		head, rest, ok := strings.Cut(path, ".")
+		if !ok {
+			return nil, false
+		}
+		nested, ok := claims[head].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		claims, path = nested, rest
+	}
+}
+
+// claimAttribute returns the attribute recording the claim value v under key.
+func claimAttribute(key attribute.Key, v any) (attribute.KeyValue, bool) {
+	switch v := v.(type) {
+	case string:
+		return key.String(v), true
+	case bool:
+		return key.Bool(v), true
+	case int:
+		return key.Int(v), true
+	case int64:
+		return key.Int64(v), true
+	case float64:
+		if v == float64(int64(v)) {
+			// JSON numbers are decoded as float64, timestamps such as exp
+			// are integers.
+			return key.Int64(int64(v)), true
+		}
+		return key.Float64(v), true
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return key.Int64(i), true
+		}
+		if f, err := v.Float64(); err == nil {
+			return key.Float64(f), true
+		}
+	case []string:
+		return key.StringSlice(v), true
+	case []any:
+		// Arrays of strings, as aud or roles, are recorded as such, others
+		// as their JSON text.
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				break
+			}
+			values = append(values, s)
+		}
+		if len(values) == len(v) {
+			return key.StringSlice(values), true
+		}
+		if b, err := json.Marshal(v); err == nil {
+			return key.String(string(b)), true
+		}
+	}
+	return attribute.KeyValue{}, false
+}
@@ -0,0 +1,47 @@
+package otelgrpcgw
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc/metadata"
+)
+
+// metadataCarrier adapts metadata.MD to propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+var _ propagation.TextMapCarrier = metadataCarrier{}
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// MetadataAnnotator returns the W3C trace context of the span active in ctx as
+// gRPC metadata, so that the gRPC backend continues the trace of the gateway
+// request. It is meant to be registered with runtime.WithMetadata:
+//
+//	mux := runtime.NewServeMux(
+//		runtime.WithMiddlewares(otelgrpcgw.NewMiddleware("gateway")),
+//		runtime.WithMetadata(otelgrpcgw.MetadataAnnotator),
+//	)
+func MetadataAnnotator(ctx context.Context, _ *http.Request) metadata.MD {
+	md := metadata.MD{}
+	propagation.TraceContext{}.Inject(ctx, metadataCarrier(md))
+	return md
+}
@@ -0,0 +1,73 @@
+package otelgrpcgw
+
+import (
+	"go.opentelemetry.io/otel/metric"
+)
+
+// renamingMeter is a metric.Meter creating all instruments under the name
+// returned by namer for their default name.
+type renamingMeter struct {
+	metric.Meter
+
+	namer func(string) string
+}
+
+func newRenamingMeter(m metric.Meter, namer func(string) string) metric.Meter {
+	return &renamingMeter{Meter: m, namer: namer}
+}
+
+func (m *renamingMeter) Int64Counter(name string, options ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return m.Meter.Int64Counter(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Int64UpDownCounter(name string, options ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	return m.Meter.Int64UpDownCounter(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Int64Histogram(name string, options ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	return m.Meter.Int64Histogram(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Int64Gauge(name string, options ...metric.Int64GaugeOption) (metric.Int64Gauge, error) {
+	return m.Meter.Int64Gauge(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Int64ObservableCounter(name string, options ...metric.Int64ObservableCounterOption) (metric.Int64ObservableCounter, error) {
+	return m.Meter.Int64ObservableCounter(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Int64ObservableUpDownCounter(name string, options ...metric.Int64ObservableUpDownCounterOption) (metric.Int64ObservableUpDownCounter, error) {
+	return m.Meter.Int64ObservableUpDownCounter(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Int64ObservableGauge(name string, options ...metric.Int64ObservableGaugeOption) (metric.Int64ObservableGauge, error) {
+	return m.Meter.Int64ObservableGauge(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Float64Counter(name string, options ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	return m.Meter.Float64Counter(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Float64UpDownCounter(name string, options ...metric.Float64UpDownCounterOption) (metric.Float64UpDownCounter, error) {
+	return m.Meter.Float64UpDownCounter(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Float64Histogram(name string, options ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return m.Meter.Float64Histogram(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Float64Gauge(name string, options ...metric.Float64GaugeOption) (metric.Float64Gauge, error) {
+	return m.Meter.Float64Gauge(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Float64ObservableCounter(name string, options ...metric.Float64ObservableCounterOption) (metric.Float64ObservableCounter, error) {
+	return m.Meter.Float64ObservableCounter(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Float64ObservableUpDownCounter(name string, options ...metric.Float64ObservableUpDownCounterOption) (metric.Float64ObservableUpDownCounter, error) {
+	return m.Meter.Float64ObservableUpDownCounter(m.namer(name), options...)
+}
+
+func (m *renamingMeter) Float64ObservableGauge(name string, options ...metric.Float64ObservableGaugeOption) (metric.Float64ObservableGauge, error) {
+	return m.Meter.Float64ObservableGauge(m.namer(name), options...)
+}
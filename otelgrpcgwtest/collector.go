@@ -0,0 +1,163 @@
+// Package otelgrpcgwtest provides helpers to test handlers instrumented with
+// otelgrpcgw without wiring exporters by hand.
+package otelgrpcgwtest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/crazyfrankie/otelgrpcgw"
+)
+
+// Collector records the spans and metrics produced by the middleware in memory.
+type Collector struct {
+	spans  *tracetest.SpanRecorder
+	reader *sdkmetric.ManualReader
+
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+}
+
+// NewCollector returns a Collector backed by an always-sampling tracer
+// provider and a manual metric reader.
+func NewCollector() *Collector {
+	c := &Collector{
+		spans:  tracetest.NewSpanRecorder(),
+		reader: sdkmetric.NewManualReader(),
+	}
+	c.tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(c.spans))
+	c.meterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(c.reader))
+	return c
+}
+
+// Options returns the options that make the middleware report to c.
+func (c *Collector) Options() []otelgrpcgw.Option {
+	return []otelgrpcgw.Option{
+		otelgrpcgw.WithTracerProvider(c.tracerProvider),
+		otelgrpcgw.WithMeterProvider(c.meterProvider),
+	}
+}
+
+// TracerProvider returns the tracer provider spans are recorded with.
+func (c *Collector) TracerProvider() *sdktrace.TracerProvider {
+	return c.tracerProvider
+}
+
+// MeterProvider returns the meter provider metrics are recorded with.
+func (c *Collector) MeterProvider() *sdkmetric.MeterProvider {
+	return c.meterProvider
+}
+
+// Spans returns the spans that have ended so far.
+func (c *Collector) Spans() []sdktrace.ReadOnlySpan {
+	return c.spans.Ended()
+}
+
+// Metrics collects and returns the metrics recorded so far.
+func (c *Collector) Metrics(t testing.TB) []metricdata.Metrics {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := c.reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect metrics: %v", err)
+	}
+
+	var metrics []metricdata.Metrics
+	for _, sm := range rm.ScopeMetrics {
+		metrics = append(metrics, sm.Metrics...)
+	}
+	return metrics
+}
+
+// AssertSpan asserts that an ended span with the given name carries all attrs
+// and returns the first such span. It returns nil if none matched.
+func (c *Collector) AssertSpan(t testing.TB, name string, attrs ...attribute.KeyValue) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	var found bool
+	for _, s := range c.Spans() {
+		if s.Name() != name {
+			continue
+		}
+		found = true
+		if containsAll(attribute.NewSet(s.Attributes()...), attrs) {
+			return s
+		}
+	}
+
+	if !found {
+		t.Errorf("no span named %q", name)
+	} else {
+		t.Errorf("no span named %q with attributes %v", name, attrs)
+	}
+	return nil
+}
+
+// AssertMetric asserts that the named metric has a data point carrying all
+// attrs and returns the metric. It returns an empty metricdata.Metrics if none
+// matched.
+func (c *Collector) AssertMetric(t testing.TB, name string, attrs ...attribute.KeyValue) metricdata.Metrics {
+	t.Helper()
+
+	for _, m := range c.Metrics(t) {
+		if m.Name != name {
+			continue
+		}
+		for _, set := range dataPointAttributes(m.Data) {
+			if containsAll(set, attrs) {
+				return m
+			}
+		}
+		t.Errorf("no data point of metric %q with attributes %v", name, attrs)
+		return metricdata.Metrics{}
+	}
+
+	t.Errorf("no metric named %q", name)
+	return metricdata.Metrics{}
+}
+
+func containsAll(set attribute.Set, attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if v, ok := set.Value(kv.Key); !ok || v != kv.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func dataPointAttributes(data metricdata.Aggregation) []attribute.Set {
+	var sets []attribute.Set
+	switch d := data.(type) {
+	case metricdata.Histogram[int64]:
+		for _, dp := range d.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Histogram[float64]:
+		for _, dp := range d.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Sum[int64]:
+		for _, dp := range d.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Sum[float64]:
+		for _, dp := range d.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Gauge[int64]:
+		for _, dp := range d.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Gauge[float64]:
+		for _, dp := range d.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	}
+	return sets
+}
@@ -0,0 +1,62 @@
+package otelgrpcgwtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/crazyfrankie/otelgrpcgw"
+)
+
+// recordingT captures assertion failures instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func serve(c *Collector, method string) {
+	h := otelgrpcgw.NewHandler(func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.WriteHeader(http.StatusCreated)
+	}, "hello", c.Options()...)
+	h(httptest.NewRecorder(), httptest.NewRequest(method, "/v1/hello", nil), nil)
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	serve(c, http.MethodPost)
+
+	span := c.AssertSpan(t, "hello",
+		semconv.HTTPRequestMethodPost,
+		semconv.HTTPResponseStatusCode(http.StatusCreated),
+	)
+	assert.NotNil(t, span)
+
+	m := c.AssertMetric(t, "http.server.request.duration",
+		semconv.HTTPRequestMethodKey.String(http.MethodPost),
+		semconv.HTTPResponseStatusCode(http.StatusCreated),
+	)
+	assert.Equal(t, "s", m.Unit)
+}
+
+func TestCollectorFailures(t *testing.T) {
+	c := NewCollector()
+	serve(c, http.MethodGet)
+
+	rt := &recordingT{TB: t}
+	assert.Nil(t, c.AssertSpan(rt, "missing"))
+	assert.Nil(t, c.AssertSpan(rt, "hello", attribute.String("missing", "value")))
+	assert.Empty(t, c.AssertMetric(rt, "missing").Name)
+	assert.Empty(t, c.AssertMetric(rt, "http.server.request.duration", semconv.HTTPRequestMethodPost).Name)
+	assert.Len(t, rt.errors, 4)
+}
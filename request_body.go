@@ -0,0 +1,40 @@
+package otelgrpcgw
+
+import (
+	"io"
+	"sync"
+)
+
+// closeNotifyingBody calls onClose the first time the request body it wraps is
+// closed. It is wrapped by the generated request.BodyWrapper, so that closing
+// either of them is noticed.
+type closeNotifyingBody struct {
+	io.ReadCloser
+
+	mu      sync.Mutex
+	onClose func() // reset once called or detached
+}
+
+// Close closes the body and calls onClose unless it was already closed or
+// detached.
+func (b *closeNotifyingBody) Close() error {
+	err := b.ReadCloser.Close()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.onClose != nil {
+		b.onClose()
+		b.onClose = nil
+	}
+	return err
+}
+
+// detach makes later calls to Close no longer call onClose. Once it returns,
+// onClose is not running and will not be called anymore.
+func (b *closeNotifyingBody) detach() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.onClose = nil
+}
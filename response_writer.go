@@ -0,0 +1,36 @@
+package otelgrpcgw
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// responseObserver wraps the http.ResponseWriter given to the generated
+// request.RespWriterWrapper, to observe what the wrapper does not report. The
+// wrapper calls it for every status it writes, including the implicit one of a
+// first Write or Flush.
+type responseObserver struct {
+	http.ResponseWriter
+	onWriteHeader func(statusCode int) // called with the first status written, may be nil
+
+	once    sync.Once
+	flushes atomic.Int64
+}
+
+// WriteHeader calls onWriteHeader the first time, and writes the status.
+func (w *responseObserver) WriteHeader(statusCode int) {
+	if w.onWriteHeader != nil {
+		w.once.Do(func() { w.onWriteHeader(statusCode) })
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush implements http.Flusher, counting the flushes and flushing the wrapped
+// http.ResponseWriter if it supports it.
+func (w *responseObserver) Flush() {
+	w.flushes.Add(1)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,63 @@
+package otelgrpcgw
+
+import (
+	"net/http"
+	"strings"
+)
+
+// spanNameTemplate is a parsed span name template, see WithSpanNameTemplate.
+type spanNameTemplate []spanNamePart
+
+// spanNamePart is either a literal or, when placeholder is set, the name of a
+// placeholder within braces.
+type spanNamePart struct {
+	text        string
+	placeholder bool
+}
+
+func parseSpanNameTemplate(tmpl string) spanNameTemplate {
+	var t spanNameTemplate
+	for tmpl != "" {
+		start := strings.IndexByte(tmpl, '{')
+		end := -1
+		if start >= 0 {
+			end = strings.IndexByte(tmpl[start:], '}')
+		}
+		if end < 0 {
+			t = append(t, spanNamePart{text: tmpl})
+			break
+		}
+		end += start
+		if start > 0 {
+			t = append(t, spanNamePart{text: tmpl[:start]})
+		}
+		t = append(t, spanNamePart{text: tmpl[start+1 : end], placeholder: true})
+		tmpl = tmpl[end+1:]
+	}
+	return t
+}
+
+// render resolves the placeholders of t for a request. Unknown placeholders
+// are kept as is, missing path parameters resolve to an empty string.
+func (t spanNameTemplate) render(operation, route string, r *http.Request, pathParams map[string]string) string {
+	var b strings.Builder
+	for _, p := range t {
+		if !p.placeholder {
+			b.WriteString(p.text)
+			continue
+		}
+		switch name, isParam := strings.CutPrefix(p.text, "param."); {
+		case isParam:
+			b.WriteString(pathParams[name])
+		case p.text == "method":
+			b.WriteString(r.Method)
+		case p.text == "route":
+			b.WriteString(route)
+		case p.text == "operation":
+			b.WriteString(operation)
+		default:
+			b.WriteString("{" + p.text + "}")
+		}
+	}
+	return b.String()
+}
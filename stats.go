@@ -0,0 +1,109 @@
+package otelgrpcgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+)
+
+// Stats is a snapshot of the counters kept by a Middleware configured
+// WithSelfStats.
+type Stats struct {
+	Requests int64 `json:"requests"` // requests handled by the middleware
+	Filtered int64 `json:"filtered"` // requests excluded by a filter, see WithFilter
+	Traced   int64 `json:"traced"`   // requests whose span was recording
+	Errors   int64 `json:"errors"`   // requests whose span status was set to error
+}
+
+// selfStats holds the counters behind Stats. A nil *selfStats counts nothing.
+type selfStats struct {
+	requests atomic.Int64
+	filtered atomic.Int64
+	traced   atomic.Int64
+	errors   atomic.Int64
+}
+
+func (s *selfStats) addRequest() {
+	if s != nil {
+		s.requests.Add(1)
+	}
+}
+
+func (s *selfStats) addFiltered() {
+	if s != nil {
+		s.filtered.Add(1)
+	}
+}
+
+func (s *selfStats) addTraced() {
+	if s != nil {
+		s.traced.Add(1)
+	}
+}
+
+func (s *selfStats) addError() {
+	if s != nil {
+		s.errors.Add(1)
+	}
+}
+
+// Stats returns the current value of the counters kept by the middleware. It
+// is zero unless the middleware was configured WithSelfStats.
+func (m *Middleware) Stats() Stats {
+	s := m.h.stats
+	if s == nil {
+		return Stats{}
+	}
+	return Stats{
+		Requests: s.requests.Load(),
+		Filtered: s.filtered.Load(),
+		Traced:   s.traced.Load(),
+		Errors:   s.errors.Load(),
+	}
+}
+
+// DebugHandler returns an http.Handler serving the Stats of the middleware as
+// JSON, meant to be mounted on an internal path next to the gateway mux.
+func (m *Middleware) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(m.Stats())
+	})
+}
+
+// Names of the counters of the spans created and suppressed by the middleware.
+const (
+	spansCreatedName    = "otelgrpcgw.spans.created"
+	spansSuppressedName = "otelgrpcgw.spans.suppressed"
+)
+
+// spanCounters counts the requests whose span is recording, and those whose
+// span is not because of a filter, the sampler or the tracing circuit breaker.
+type spanCounters struct {
+	created    metric.Int64Counter
+	suppressed metric.Int64Counter
+}
+
+func newSpanCounters(meter metric.Meter) spanCounters {
+	var c spanCounters
+	var err error
+	c.created, err = meter.Int64Counter(spansCreatedName,
+		metric.WithUnit("{span}"),
+		metric.WithDescription("Number of recording spans started by the middleware."))
+	if err != nil {
+		otel.Handle(err)
+		c.created = metricnoop.Int64Counter{}
+	}
+	c.suppressed, err = meter.Int64Counter(spansSuppressedName,
+		metric.WithUnit("{span}"),
+		metric.WithDescription("Number of requests served without a recording span by the middleware."))
+	if err != nil {
+		otel.Handle(err)
+		c.suppressed = metricnoop.Int64Counter{}
+	}
+	return c
+}
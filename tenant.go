@@ -0,0 +1,39 @@
+package otelgrpcgw
+
+import "sync"
+
+// tenantCardinalityLimit bounds the number of distinct tenants recorded as a
+// metric attribute.
+const tenantCardinalityLimit = 100
+
+// tenantOverflow replaces the tenants seen after tenantCardinalityLimit on
+// metrics.
+const tenantOverflow = "_other"
+
+// tenantSet remembers the tenants recorded on metrics, up to a limit.
+type tenantSet struct {
+	limit int
+
+	mu      sync.Mutex
+	tenants map[string]struct{}
+}
+
+func newTenantSet(limit int) *tenantSet {
+	return &tenantSet{limit: limit, tenants: make(map[string]struct{})}
+}
+
+// metricValue returns tenant if it was seen before or the limit is not
+// reached yet, and tenantOverflow otherwise.
+func (s *tenantSet) metricValue(tenant string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenant]; ok {
+		return tenant
+	}
+	if len(s.tenants) >= s.limit {
+		return tenantOverflow
+	}
+	s.tenants[tenant] = struct{}{}
+	return tenant
+}
@@ -1,19 +1,115 @@
 package otelgrpcgw
 
 import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
 )
 
 // Attribute keys that can be added to a span.
 const (
 	ReadBytesKey  = attribute.Key("http.read_bytes")  // if anything was read from the request body, the total number of bytes read
-	ReadErrorKey  = attribute.Key("http.read_error")  // If an error occurred while reading a request, the string of the error (io.EOF is not recorded)
+	ReadErrorKey  = attribute.Key("http.read_error")  // If an error occurred while reading a request, the string of the error (io.EOF is not recorded, see WithRecordEOFErrors)
 	WroteBytesKey = attribute.Key("http.wrote_bytes") // if anything was written to the response writer, the total number of bytes written
-	WriteErrorKey = attribute.Key("http.write_error") // if an error occurred while writing a reply, the string of the error (io.EOF is not recorded)
+	WriteErrorKey = attribute.Key("http.write_error") // if an error occurred while writing a reply, the string of the error (io.EOF is not recorded, see WithRecordEOFErrors)
+
+	OperationConfiguredKey = attribute.Key("http.operation_configured")  // the static operation the middleware was created with, see WithDiagnosticAttributes
+	RequestBodyChecksumKey = attribute.Key("http.request.body.checksum") // hex encoded SHA-256 of the request body bytes read by the handler, see WithBodyChecksum
+	RetryAttemptKey        = attribute.Key("http.request.retry_attempt") // the client retry attempt number, see WithRetryAttemptHeader
+
+	RequestBodyUncompressedSizeKey = attribute.Key("http.request.body.uncompressed_size") // the decompressed size of a Content-Encoding compressed request body, see WithDecodeRequestSize
+	RequestContentTypeKey          = attribute.Key("http.request.content_type")           // the media type of the request Content-Type, without parameters, see WithRequestContentTypeAttribute
+	CorrelationHeaderKey           = attribute.Key("correlation.header")                  // the header a span link was parsed from, see WithCorrelationLinkHeader
+	CacheStatusKey                 = attribute.Key("http.response.cache_status")          // whether the response was served from a cache, e.g. HIT or MISS, see WithCacheStatusHeader
+	GatewayPatternKey              = attribute.Key("gateway.pattern")                     // the grpc-gateway pattern reported by the pattern observer, see WithPatternObserver
+	RequestStartUnixNanoKey        = attribute.Key("http.request.start_unix_nano")        // the wall-clock time the request started, see WithTimestampAttributes
+	ResponseEndUnixNanoKey         = attribute.Key("http.response.end_unix_nano")         // the wall-clock time the response ended, see WithTimestampAttributes
+	BackendAddressKey              = attribute.Key("server.socket.address")               // the address of the gRPC backend the request is forwarded to, see WithBackendResolver
+	LatencyBucketKey               = attribute.Key("http.server.latency_bucket")          // whether the request was fast, normal or slow, see WithLatencyBuckets
+	SampledKey                     = attribute.Key("otel.sampled")                        // whether the span was sampled, see WithSamplingDecisionAttribute
+	ErrorKindKey                   = attribute.Key("http.error.kind")                     // protocol if reading the request failed, timeout if its deadline was exceeded, application if the handler failed otherwise
+	ServerTimeoutKey               = attribute.Key("http.server.timeout")                 // set to true when the request deadline was exceeded while it was handled
+	PathParamCountKey              = attribute.Key("http.route.param_count")              // the number of path parameters the request matched, see WithPathParamCount
+	UnmatchedRouteKey              = attribute.Key("http.route.unmatched")                // set to true on the span of a 404 without a known route or path parameters, see WithoutUnmatchedRouteTracing
+	APIVersionKey                  = attribute.Key("http.api.version")                    // the API version the request targets, see WithAPIVersionExtractor
+	RateLimitLimitKey              = attribute.Key("http.response.rate_limit.limit")      // the request quota of the client, see WithRateLimitHeaders
+	RateLimitRemainingKey          = attribute.Key("http.response.rate_limit.remaining")  // the requests left in the quota of the client, see WithRateLimitHeaders
+	RateLimitResetKey              = attribute.Key("http.response.rate_limit.reset")      // when the quota of the client resets, see WithRateLimitHeaders
+	ClientCertSubjectCNKey         = attribute.Key("tls.client.subject.common_name")      // the subject common name of the TLS client certificate, see WithClientCertAttributes
+	ClientCertSerialKey            = attribute.Key("tls.client.serial_number")            // the hex encoded serial number of the TLS client certificate, see WithClientCertAttributes
+	OperationGroupKey              = attribute.Key("http.operation.group")                // the logical operation group of the request, see WithOperationGroupFn
+	InFlightRequestsKey            = attribute.Key("http.server.in_flight_requests")      // the number of requests in flight in the middleware when a slow request ended, see WithConcurrencySnapshot
+	GoroutinesKey                  = attribute.Key("go.goroutines")                       // the number of goroutines when a slow request ended, see WithConcurrencySnapshot
+	RequestBodyLengthMismatchKey   = attribute.Key("http.request.body.length_mismatch")   // set to true when the request body read to its end did not match its Content-Length
+	RequestBodyDeclaredSizeKey     = attribute.Key("http.request.body.declared_size")     // the Content-Length of a request body whose length did not match it
+	RequestBodyReadSizeKey         = attribute.Key("http.request.body.read_size")         // the bytes read from a request body whose length did not match its Content-Length
+	TenantIDKey                    = attribute.Key("tenant.id")                           // the logical tenant of the request, see WithTenantExtractor
+	RequestDurationNanosKey        = attribute.Key("http.server.request.duration_ns")     // the duration of the request in nanoseconds, see WithNanosecondDurationAttribute
+	RequestLanguageKey             = attribute.Key("http.request.language")               // the language preferred by the client, see WithLanguageAttribute
+	HTTP2StreamIDKey               = attribute.Key("http2.stream_id")                     // the HTTP/2 stream the request was received on, see WithHTTP2StreamAttribute
+	RequestOriginKey               = attribute.Key("http.request.origin")                 // the allowlisted Origin of the request, or other, see WithOriginAttribute
+	ResponseCompressedKey          = attribute.Key("http.response.compressed")            // whether the response has a Content-Encoding, see WithResponseCompressionAttribute
+	TransactionIDKey               = attribute.Key("transaction.id")                      // the business transaction ID of the request, see WithTransactionIDExtractor
+	RequestRangeKey                = attribute.Key("http.request.range")                  // the Range request header, see WithRangeAttributes
+	ResponseContentRangeKey        = attribute.Key("http.response.content_range")         // the Content-Range response header, see WithRangeAttributes
+	DeadlinePropagatedKey          = attribute.Key("rpc.grpc.deadline_propagated")        // whether a deadline is propagated to the gRPC backend, see WithDeadlinePropagationAttribute
+	PropagatedTimeoutKey           = attribute.Key("rpc.grpc.propagated_timeout_ms")      // the timeout propagated to the gRPC backend in milliseconds, see WithDeadlinePropagationAttribute
+	CombinedProtocolKey            = attribute.Key("http.request.proto")                  // the transport security and protocol version of the request, see WithCombinedProtocolAttribute
+	IdempotencyKeyKey              = attribute.Key("http.request.idempotency_key")        // the idempotency key of the request, see WithIdempotencyKeyHeader
+	ResponseETagKey                = attribute.Key("http.response.etag")                  // the ETag response header, see WithCacheValidatorAttributes
+	ResponseLastModifiedKey        = attribute.Key("http.response.last_modified")         // the Last-Modified response header, see WithCacheValidatorAttributes
+	ConditionalRequestKey          = attribute.Key("http.request.conditional")            // whether the request has an If-None-Match or If-Modified-Since header, see WithConditionalRequestAttributes
+	ResponseFlushCountKey          = attribute.Key("http.response.flush_count")           // the number of times the response was flushed, see WithFlushCountAttribute
+	RequestHeaderCountKey          = attribute.Key("http.request.header.count")           // the number of request header fields, see WithHeaderSizeAttributes
+	RequestHeaderSizeKey           = attribute.Key("http.request.header.size")            // the approximate size of the request header fields in bytes, see WithHeaderSizeAttributes
+	ClientGeoCountryKey            = attribute.Key("client.geo.country")                  // the country code of the client set by a CDN, see WithGeoHeader
+	RequestAuthSchemeKey           = attribute.Key("http.request.auth_scheme")            // the scheme of the Authorization header, see WithAuthSchemeAttribute
+	ResponseSizeBucketKey          = attribute.Key("http.response.size_bucket")           // whether the response body was small, medium, large or xlarge, see WithResponseSizeBuckets
+	OutboundContentTypeKey         = attribute.Key("gateway.outbound_content_type")       // the Content-Type of the response, see WithOutboundContentTypeAttribute
+	SamplingPriorityKey            = attribute.Key("sampling.priority")                   // the sampling priority hinted to tail-based samplers, see WithSamplingPriorityFn
+	ResponseVaryKey                = attribute.Key("http.response.vary")                  // the Vary response header, see WithVaryAttribute
+)
+
+// Span event names.
+const (
+	StatusWrittenEvent   = "response.status_written" // the handler wrote the response status, see WithStatusWriteEvent
+	EventsTruncatedEvent = "events.truncated"        // subsequent read and write events were dropped, see WithMaxBodyEvents
+	FilterPanicEvent     = "filter.panic"            // a filter panicked while deciding on the request, see WithFilterPanicPolicy
+	RouteParamsEvent     = "route.params"            // the path parameters of the request, see WithPathParamEvents
+	BodyClosedEvent      = "request.body.closed"     // the request body was closed, see WithBodyCloseEvent
+	ExtractionDoneEvent  = "extraction_done"         // the trace context was extracted from the request, see WithPhaseEvents
+	HandlerStartEvent    = "handler_start"           // the wrapped handler was called, see WithPhaseEvents
+	HandlerDoneEvent     = "handler_done"            // the wrapped handler returned, see WithPhaseEvents
+	MetricsRecordedEvent = "metrics_recorded"        // the metrics of the request were recorded, see WithPhaseEvents
 )
 
+// RequestBodyFieldKeyPrefix prefixes the attributes recorded for JSON request
+// body fields, see WithBodyFieldAttributes.
+const RequestBodyFieldKeyPrefix = "http.request.body.field."
+
+// RouteParamKeyPrefix prefixes the attributes of the route.params event, see
+// WithPathParamEvents.
+const RouteParamKeyPrefix = "route.param."
+
+// ResponseBodyFieldKeyPrefix prefixes the attributes recorded for JSON response
+// body fields, see WithResponseBodyFieldAttributes.
+const ResponseBodyFieldKeyPrefix = "http.response.body.field."
+
+// JWTClaimKeyPrefix prefixes the attributes recorded for token claims, see
+// WithJWTClaimAttributes.
+const JWTClaimKeyPrefix = "jwt.claim."
+
 func newTracer(tp trace.TracerProvider) trace.Tracer {
 	return tp.Tracer(ScopeName, trace.WithInstrumentationVersion(Version()))
 }
@@ -21,3 +117,248 @@ func newTracer(tp trace.TracerProvider) trace.Tracer {
 func newMeter(mp metric.MeterProvider) metric.Meter {
 	return mp.Meter(ScopeName, metric.WithInstrumentationVersion(Version()))
 }
+
+// isNoopTracerProvider reports whether tp is known to never record spans.
+// The global provider is never considered no-op since it may be replaced later.
+func isNoopTracerProvider(tp trace.TracerProvider) bool {
+	_, ok := tp.(tracenoop.TracerProvider)
+	return ok
+}
+
+// isNoopMeterProvider reports whether mp is known to never record measurements.
+func isNoopMeterProvider(mp metric.MeterProvider) bool {
+	_, ok := mp.(metricnoop.MeterProvider)
+	return ok
+}
+
+// mediaType returns the lower-cased media type of a Content-Type header value
+// without its parameters.
+func mediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// isStandardMethod reports whether method is one of the HTTP methods defined
+// by RFC 9110 and RFC 5789.
+func isStandardMethod(method string) bool {
+	switch method {
+	case http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPatch, http.MethodPost, http.MethodPut, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// parseCorrelationLink parses a link from a header value holding a hex trace
+// ID followed by "-" or ":" and a hex span ID. Values without a valid span ID
+// yield no link, since a link to an invalid span context is dropped by
+// exporters.
+func parseCorrelationLink(header, value string) (trace.Link, bool) {
+	traceHex, spanHex, ok := strings.Cut(strings.TrimSpace(value), "-")
+	if !ok {
+		traceHex, spanHex, _ = strings.Cut(traceHex, ":")
+	}
+
+	traceID, err := trace.TraceIDFromHex(traceHex)
+	if err != nil {
+		return trace.Link{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(spanHex)
+	if err != nil {
+		return trace.Link{}, false
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, Remote: true})
+	if !sc.IsValid() {
+		return trace.Link{}, false
+	}
+
+	return trace.Link{
+		SpanContext: sc,
+		Attributes:  []attribute.KeyValue{CorrelationHeaderKey.String(header)},
+	}, true
+}
+
+// cacheStatus reduces a cache status header value such as "HIT from proxy" to
+// its upper-cased first token, to keep it low-cardinality.
+func cacheStatus(value string) string {
+	if fields := strings.Fields(value); len(fields) > 0 {
+		return strings.ToUpper(strings.TrimRight(fields[0], ",;"))
+	}
+	return ""
+}
+
+// errorKind returns "protocol" when reading the request body failed, e.g. on
+// malformed chunked encoding, "timeout" when the request deadline was
+// exceeded, "application" when the request failed otherwise, and an empty
+// string when it did not fail.
+func errorKind(readErr error, timedOut bool, status codes.Code) string {
+	if readErr != nil && !errors.Is(readErr, io.EOF) {
+		return "protocol"
+	}
+	if timedOut {
+		return "timeout"
+	}
+	if status == codes.Error {
+		return "application"
+	}
+	return ""
+}
+
+// forwardedClientIP returns the X-Forwarded-For entry preceding the last
+// trustedProxies entries, or the leftmost entry when there are not enough.
+func forwardedClientIP(xForwardedFor string, trustedProxies int) string {
+	if xForwardedFor == "" {
+		return ""
+	}
+	hops := strings.Split(xForwardedFor, ",")
+	i := max(len(hops)-1-trustedProxies, 0)
+	return strings.TrimSpace(hops[i])
+}
+
+// isVersionSegment reports whether a path segment is an API version like "v1".
+func isVersionSegment(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
+	}
+	for _, c := range segment[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// preferredLanguage returns the language tag with the highest quality value of
+// an Accept-Language header value, the first one among equals, or an empty
+// string when there is none.
+func preferredLanguage(acceptLanguage string) string {
+	var best string
+	bestQ := 0.0
+	for _, entry := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(entry, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
+
+// defaultRedactedQueryParams are the query parameters carrying credentials in
+// common signed URLs, redacted by WithFullURLAttribute.
+var defaultRedactedQueryParams = []string{"AWSAccessKeyId", "Signature", "sig", "X-Goog-Signature"}
+
+// redactedValue replaces the values of the redacted query parameters.
+const redactedValue = "REDACTED"
+
+// fullURL returns the URL of r with the given scheme, without its user info
+// and with the values of the redacted query parameters, keyed in lower case,
+// replaced. The order of the query parameters is kept.
+func fullURL(r *http.Request, scheme string, redacted map[string]struct{}) string {
+	u := url.URL{
+		Scheme:  scheme,
+		Host:    r.Host,
+		Path:    r.URL.Path,
+		RawPath: r.URL.RawPath,
+	}
+	if r.URL.RawQuery == "" {
+		return u.String()
+	}
+
+	params := strings.Split(r.URL.RawQuery, "&")
+	for i, param := range params {
+		key, _, hasValue := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if _, ok := redacted[strings.ToLower(name)]; ok && hasValue {
+			params[i] = key + "=" + redactedValue
+		}
+	}
+	u.RawQuery = strings.Join(params, "&")
+	return u.String()
+}
+
+// combinedProtocol returns the transport security and protocol version of r,
+// e.g. h2c for HTTP/2 without TLS or https1.1 for HTTP/1.1 with TLS.
+func combinedProtocol(r *http.Request) string {
+	switch r.ProtoMajor {
+	case 2:
+		if r.TLS != nil {
+			return "h2"
+		}
+		return "h2c"
+	case 3:
+		return "h3"
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + strconv.Itoa(r.ProtoMajor) + "." + strconv.Itoa(r.ProtoMinor)
+}
+
+// headerSize returns the number of fields of h and their size when written as
+// "Name: value\r\n" lines.
+func headerSize(h http.Header) (count, size int) {
+	for name, values := range h {
+		for _, v := range values {
+			count++
+			size += len(name) + len(": ") + len(v) + len("\r\n")
+		}
+	}
+	return count, size
+}
+
+// countryCode returns the upper-cased two-character country code in v, e.g.
+// US or T1, or an empty string if v is not one.
+func countryCode(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) != 2 {
+		return ""
+	}
+	for _, c := range []byte(v) {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return ""
+		}
+	}
+	return strings.ToUpper(v)
+}
+
+// authScheme returns the scheme of the Authorization header value v, or an
+// empty string if v does not start with a scheme followed by credentials.
+func authScheme(v string) string {
+	scheme, _, ok := strings.Cut(strings.TrimSpace(v), " ")
+	if !ok || scheme == "" {
+		return ""
+	}
+	for _, c := range []byte(scheme) {
+		if !isTokenChar(c) {
+			return ""
+		}
+	}
+	return scheme
+}
+
+// isTokenChar reports whether c may appear in an HTTP token, see RFC 9110
+// section 5.6.2.
+func isTokenChar(c byte) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}